@@ -2,18 +2,35 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
-	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
+	"google.golang.org/grpc"
 
 	"github.com/paramonies/internal/config"
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/grpcserver"
 	"github.com/paramonies/internal/handlers"
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/policy"
+	"github.com/paramonies/internal/recorder"
 	"github.com/paramonies/internal/routes"
+	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/sweeper"
+	"github.com/paramonies/internal/tracing"
+	"github.com/paramonies/internal/urlnorm"
 )
 
 var (
@@ -28,33 +45,161 @@ func main() {
 	var cfg config.Config
 	err := cfg.Init()
 	if err != nil {
-		log.Fatal(err)
+		logger.Log.Fatal("failed to start service", zap.Error(err))
 	}
 
-	r, err := config.NewRepository(&cfg)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.TraceExporter, cfg.TraceEndpoint)
 	if err != nil {
-		log.Fatal(err)
+		logger.Log.Fatal("failed to start service", zap.Error(err))
+	}
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+
+	r, err := config.NewRepository(&cfg, reg)
+	if err != nil {
+		logger.Log.Fatal("failed to start service", zap.Error(err))
 	}
 	defer r.Close()
-	h := handlers.New(r, cfg.BaseURL)
+
+	if cached, ok := r.(*store.CachedRepository); ok {
+		expvar.Publish("repository_cache", expvar.Func(func() interface{} {
+			return cached.CacheStats()
+		}))
+	}
+
+	gen, err := config.NewIDGenerator(&cfg)
+	if err != nil {
+		logger.Log.Fatal("failed to start service", zap.Error(err))
+	}
+
+	// ctx is cancelled on shutdown and stops background jobs
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	del := deleter.New(r, cfg.DeleteBatchSize, cfg.DeleteFlushInterval)
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "shortener",
+		Subsystem: "deleter",
+		Name:      "queue_length",
+		Help:      "Number of URLs queued for deletion.",
+	}, func() float64 {
+		return float64(del.QueueLen())
+	}))
+
+	rec := recorder.New(r, cfg.ClickBufferSize)
+	reg.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "shortener",
+		Subsystem: "clicks",
+		Name:      "queue_length",
+		Help:      "Number of clicks queued for recording.",
+	}, func() float64 {
+		return float64(rec.QueueLen())
+	}), prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: "shortener",
+		Subsystem: "clicks",
+		Name:      "dropped_total",
+		Help:      "Number of clicks dropped because buffer was full.",
+	}, func() float64 {
+		return float64(rec.Dropped())
+	}))
+
+	pol, err := policy.New(cfg.PolicySchemes, cfg.BaseURL, cfg.PolicyDomainsFile, cfg.PolicyReloadInterval)
+	if err != nil {
+		logger.Log.Fatal("failed to start service", zap.Error(err))
+	}
+	go pol.Watch(ctx)
+
+	norm := urlnorm.Options{StripTracking: cfg.URLStripTracking, KeepOriginal: cfg.URLKeepOriginal}
+	h := handlers.New(r, del, rec, cfg.BaseURL, gen, cfg.AnalyticsSalt, norm, pol)
+	go sweeper.New(r, cfg.SweepInterval, cfg.DeletedRetention).Run(ctx)
+
+	httpMetrics, err := middleware.NewHTTPMetrics(reg)
+	if err != nil {
+		logger.Log.Fatal("failed to start service", zap.Error(err))
+	}
 
 	//HTTP Server
 	server := &http.Server{
 		Addr:    cfg.SrvAddr,
-		Handler: routes.New(h),
+		Handler: routes.New(h, &cfg, httpMetrics),
+	}
+
+	//Admin Server
+	var adminServer *http.Server
+	if cfg.AdminAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		mux.Handle("/log/level", logger.LevelHandler())
+		adminServer = &http.Server{Addr: cfg.AdminAddr, Handler: mux}
+
+		go func() {
+			logger.Log.Info("starting admin server", zap.String("address", cfg.AdminAddr))
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				logger.Log.Fatal("admin server ListenAndServe", zap.Error(err))
+			}
+		}()
+	}
+
+	//gRPC Server
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" {
+		listen, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			logger.Log.Fatal("failed to start service", zap.Error(err))
+		}
+		signer := middleware.NewCookieSigner(cfg.SecretKey, cfg.PreviousSecretKeys)
+		subnets, err := middleware.ParseTrustedSubnets(cfg.TrustedSubnet)
+		if err != nil {
+			logger.Log.Fatal("failed to start service", zap.Error(err))
+		}
+		proxies, err := middleware.ParseTrustedSubnets(cfg.TrustedProxies)
+		if err != nil {
+			logger.Log.Fatal("failed to start service", zap.Error(err))
+		}
+		grpcServer = grpcserver.New(h, signer, subnets, proxies)
+
+		go func() {
+			logger.Log.Info("starting gRPC server", zap.String("address", cfg.GRPCAddr))
+			if err := grpcServer.Serve(listen); err != nil {
+				logger.Log.Fatal("gRPC server Serve", zap.Error(err))
+			}
+		}()
 	}
+
 	idleConnsClosed := make(chan struct{})
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	go func() {
 		<-sigint
+		// readiness probe fails from now on, wait until load balancer notices it
+		h.Drain()
+		if cfg.ShutdownDelay > 0 {
+			logger.Log.Info("draining before shutdown", zap.Duration("delay", cfg.ShutdownDelay))
+			time.Sleep(cfg.ShutdownDelay)
+		}
+		cancel()
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
 		if err := server.Shutdown(context.Background()); err != nil {
-			log.Printf("HTTP server Shutdown: %v", err)
+			logger.Log.Error("HTTP server Shutdown", zap.Error(err))
+		}
+		// no requests are served anymore, flush queued deletions and clicks
+		del.Close()
+		rec.Close()
+		if err := shutdownTracing(context.Background()); err != nil {
+			logger.Log.Error("tracing Shutdown", zap.Error(err))
+		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(context.Background()); err != nil {
+				logger.Log.Error("admin server Shutdown", zap.Error(err))
+			}
 		}
 		close(idleConnsClosed)
 	}()
 
-	log.Printf("starting server on %s...\n", cfg.SrvAddr)
+	logger.Log.Info("starting server", zap.String("address", cfg.SrvAddr))
 
 	if *cfg.EnableHTTPS {
 		manager := &autocert.Manager{
@@ -63,13 +208,13 @@ func main() {
 		}
 		server.TLSConfig = manager.TLSConfig()
 
-		log.Printf("HTTPs enable")
+		logger.Log.Info("HTTPS enabled")
 		if err := server.ListenAndServeTLS("", ""); err != http.ErrServerClosed {
-			log.Fatalf("HTTPS server ListenAndServe: %v", err)
+			logger.Log.Fatal("HTTPS server ListenAndServe", zap.Error(err))
 		}
 	} else {
 		if err := server.ListenAndServe(); err != http.ErrServerClosed {
-			log.Fatalf("HTTP server ListenAndServe: %v", err)
+			logger.Log.Fatal("HTTP server ListenAndServe", zap.Error(err))
 		}
 	}
 
@@ -1,20 +1,35 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/paramonies/internal/config"
+	"github.com/paramonies/internal/deleter"
 	"github.com/paramonies/internal/handlers"
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/policy"
 	"github.com/paramonies/internal/routes"
+	"github.com/paramonies/internal/shortid"
+	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/urlnorm"
 )
 
 func TestMux(t *testing.T) {
@@ -29,7 +44,11 @@ func TestMux(t *testing.T) {
 		body   string
 		method string
 		path   string
-		want   want
+		realIP string
+		// eventually repeats request until response is expected, for results
+		// of asynchronous jobs
+		eventually bool
+		want       want
 	}{
 		{
 			name:   "create short url from text/plain - OK",
@@ -38,7 +57,7 @@ func TestMux(t *testing.T) {
 			path:   "/",
 			want: want{
 				status: http.StatusCreated,
-				body:   fmt.Sprintf("http://localhost:8080/%d", handlers.Hash("https://practicum.yandex.ru")),
+				body:   "http://localhost:8080/000000",
 			},
 		},
 		{
@@ -53,7 +72,7 @@ func TestMux(t *testing.T) {
 		{
 			name:   "get original URL by short ID - OK",
 			method: http.MethodGet,
-			path:   fmt.Sprintf("/%d", handlers.Hash("https://practicum.yandex.ru")),
+			path:   "/000000",
 			want: want{
 				status:   http.StatusTemporaryRedirect,
 				location: "https://practicum.yandex.ru",
@@ -65,7 +84,7 @@ func TestMux(t *testing.T) {
 			path:   fmt.Sprintf("/%s", "123"),
 			want: want{
 				status: http.StatusBadRequest,
-				body:   "id not found\n",
+				body:   "id not found\nrequest id: test\n",
 			},
 		},
 		{
@@ -75,7 +94,7 @@ func TestMux(t *testing.T) {
 			path:   "/api/shorten",
 			want: want{
 				status: http.StatusCreated,
-				body:   `{"result":"http://localhost:8080/3003527198"}`,
+				body:   `{"result":"http://localhost:8080/000001"}`,
 			},
 		},
 		{
@@ -85,7 +104,7 @@ func TestMux(t *testing.T) {
 			path:   "/api/shorten",
 			want: want{
 				status: http.StatusBadRequest,
-				body:   "unexpected end of JSON input\n",
+				body:   "unexpected end of JSON input\nrequest id: test\n",
 			},
 		},
 		{
@@ -102,7 +121,7 @@ func TestMux(t *testing.T) {
 			path:   "/api/user/urls",
 			want: want{
 				status: http.StatusOK,
-				body:   `[{"short_url":"http://localhost:8080/3003527198","original_url":"https://practicum-1.yandex.ru"},{"short_url":"http://localhost:8080/3353207204","original_url":"https://practicum.yandex.ru"}]`,
+				body:   `[{"short_url":"http://localhost:8080/000000","original_url":"https://practicum.yandex.ru"},{"short_url":"http://localhost:8080/000001","original_url":"https://practicum-1.yandex.ru"}]`,
 			},
 		},
 		{
@@ -112,63 +131,233 @@ func TestMux(t *testing.T) {
 			path:   "/api/shorten/batch",
 			want: want{
 				status: http.StatusCreated,
-				body:   `[{"correlation_id":"first","short_url":"http://localhost:8080/3159787651"},{"correlation_id":"second","short_url":"http://localhost:8080/740694524"}]`,
+				body:   `[{"correlation_id":"first","short_url":"http://localhost:8080/000002"},{"correlation_id":"second","short_url":"http://localhost:8080/000003"}]`,
 			},
 		},
 		{
 			name:   "delete many short URLs Accepted",
-			body:   `["3159787651", "740694524"]`,
+			body:   `["000002", "000003"]`,
 			method: http.MethodDelete,
 			path:   "/api/user/urls",
 			want: want{
 				status: http.StatusAccepted,
 			},
 		},
+		{
+			name:   "create short URL with alias - OK",
+			body:   `{"url":"https://practicum-4.yandex.ru","alias":"spring-sale"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusCreated,
+				body:   `{"result":"http://localhost:8080/spring-sale"}`,
+			},
+		},
+		{
+			name:   "get original URL by alias - OK",
+			method: http.MethodGet,
+			path:   "/spring-sale",
+			want: want{
+				status:   http.StatusTemporaryRedirect,
+				location: "https://practicum-4.yandex.ru",
+			},
+		},
+		{
+			name:   "get click statistics for short URL - OK",
+			method: http.MethodGet,
+			path:   "/api/user/urls/spring-sale/stats",
+			want: want{
+				status: http.StatusOK,
+				body: fmt.Sprintf(`{"short_url":"http://localhost:8080/spring-sale","clicks":1,"unique_visitors":1,"daily":[{"date":"%s","clicks":1,"unique_visitors":1}]}`,
+					time.Now().UTC().Format("2006-01-02")),
+			},
+		},
+		{
+			name:   "get click statistics for short URL - not found",
+			method: http.MethodGet,
+			path:   "/api/user/urls/unknown/stats",
+			want: want{
+				status: http.StatusNotFound,
+			},
+		},
+		{
+			name:   "create short URL with alias - taken",
+			body:   `{"url":"https://practicum-5.yandex.ru","alias":"spring-sale"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusConflict,
+				body:   "spring-sale: alias is already taken\nrequest id: test\n",
+			},
+		},
+		{
+			name:   "create short URL with alias - reserved",
+			body:   `{"url":"https://practicum-5.yandex.ru","alias":"ping"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusBadRequest,
+				body:   "ping: alias is reserved\nrequest id: test\n",
+			},
+		},
+		{
+			name:   "create short URL with alias - invalid",
+			body:   `{"url":"https://practicum-5.yandex.ru","alias":"a/b"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusBadRequest,
+			},
+		},
+		{
+			name:   "create short URL with expiration - OK",
+			body:   `{"url":"https://practicum-6.yandex.ru","alias":"expiring","expires_at":"2999-01-01T00:00:00Z"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusCreated,
+				body:   `{"result":"http://localhost:8080/expiring"}`,
+			},
+		},
+		{
+			name:   "create short URL with expiration - in the past",
+			body:   `{"url":"https://practicum-7.yandex.ru","expires_at":"2000-01-01T00:00:00Z"}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusBadRequest,
+				body:   "link expiration must be in the future\nrequest id: test\n",
+			},
+		},
+		{
+			name:   "create short URL with expiration - both expires_at and ttl_seconds",
+			body:   `{"url":"https://practicum-7.yandex.ru","expires_at":"2999-01-01T00:00:00Z","ttl_seconds":60}`,
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			want: want{
+				status: http.StatusBadRequest,
+				body:   "only one of expires_at and ttl_seconds can be set\nrequest id: test\n",
+			},
+		},
+		{
+			name:   "create many short URLs from JSON - per item results",
+			body:   `[{"correlation_id":"new","original_url":"https://practicum-8.yandex.ru"},{"correlation_id":"saved","original_url":"https://practicum.yandex.ru"},{"correlation_id":"invalid","original_url":"not url"},{"correlation_id":"taken","original_url":"https://practicum-9.yandex.ru","alias":"spring-sale"}]`,
+			method: http.MethodPost,
+			path:   "/api/shorten/batch",
+			want: want{
+				status: http.StatusCreated,
+				body:   `[{"correlation_id":"new","short_url":"http://localhost:8080/000004"},{"correlation_id":"saved","short_url":"http://localhost:8080/000000"},{"correlation_id":"invalid","error":{"code":"invalid_url","message":"invalid url: invalid URI for request"}},{"correlation_id":"taken","error":{"code":"alias_taken","message":"spring-sale: alias is already taken"}}]`,
+			},
+		},
+		{
+			name:   "create many short URLs from JSON - all invalid",
+			body:   `[{"correlation_id":"invalid","original_url":"not url"}]`,
+			method: http.MethodPost,
+			path:   "/api/shorten/batch",
+			want: want{
+				status: http.StatusBadRequest,
+				body:   `[{"correlation_id":"invalid","error":{"code":"invalid_url","message":"invalid url: invalid URI for request"}}]`,
+			},
+		},
+		{
+			name:   "get internal statistics - no X-Real-IP",
+			method: http.MethodGet,
+			path:   "/api/internal/stats",
+			want: want{
+				status: http.StatusForbidden,
+			},
+		},
+		{
+			name:   "get internal statistics - untrusted subnet",
+			method: http.MethodGet,
+			path:   "/api/internal/stats",
+			realIP: "10.0.0.1",
+			want: want{
+				status: http.StatusForbidden,
+			},
+		},
+		{
+			name:   "get internal statistics - OK",
+			method: http.MethodGet,
+			path:   "/api/internal/stats",
+			realIP: "192.168.1.10",
+			// URLs are deleted asynchronously
+			eventually: true,
+			want: want{
+				status: http.StatusOK,
+				body:   `{"urls":5,"users":1}`,
+			},
+		},
 	}
 
 	cfg := config.Config{
-		SrvAddr: "localhost:8080",
-		BaseURL: "http://localhost:8080",
+		SrvAddr:        "localhost:8080",
+		BaseURL:        "http://localhost:8080",
+		SecretKey:      "secret",
+		TrustedSubnet:  "192.168.1.0/24",
+		TrustedProxies: "127.0.0.0/8",
 	}
 
-	r, err := config.NewRepository(&cfg)
+	r, err := config.NewRepository(&cfg, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer r.Close()
-	h := handlers.New(r, cfg.BaseURL)
 
-	rtr := routes.New(h)
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	del := deleter.New(r, 0, 10*time.Millisecond)
+	defer del.Close()
+	h := handlers.New(r, del, nil, cfg.BaseURL, gen, "", urlnorm.Options{}, nil)
+
+	rtr := routes.New(h, &cfg, nil)
 	ts := httptest.NewServer(rtr)
 	defer ts.Close()
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
-			require.NoError(t, err)
+			send := func() (*http.Response, string) {
+				req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+				require.NoError(t, err)
 
-			cookie := &http.Cookie{
-				Name:  "user_id",
-				Value: "wSzPHUbHwQ/WKQ==",
-			}
-			req.AddCookie(cookie)
+				signer := middleware.NewCookieSigner(cfg.SecretKey, nil)
+				cookie := &http.Cookie{
+					Name:  middleware.UserIDCookie,
+					Value: signer.Sign("wSzPHUbHwQ/WKQ=="),
+				}
+				req.AddCookie(cookie)
+				req.Header.Set(middleware.RequestIDHeader, "test")
+				if tt.realIP != "" {
+					req.Header.Set("X-Real-IP", tt.realIP)
+				}
 
-			client := &http.Client{}
-			client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
-				return http.ErrUseLastResponse
-			}
+				client := &http.Client{}
+				client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				}
 
-			resp, err := client.Do(req)
-			require.NoError(t, err)
+				resp, err := client.Do(req)
+				require.NoError(t, err)
 
-			body, err := io.ReadAll(resp.Body)
-			defer resp.Body.Close()
-			assert.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				defer resp.Body.Close()
+				assert.NoError(t, err)
+				return resp, string(body)
+			}
+
+			if tt.eventually {
+				assert.Eventually(t, func() bool {
+					resp, body := send()
+					return resp.StatusCode == tt.want.status && body == tt.want.body
+				}, time.Second, 10*time.Millisecond)
+			}
+			resp, body := send()
 
 			assert.Equal(t, tt.want.status, resp.StatusCode)
+			assert.Equal(t, "test", resp.Header.Get(middleware.RequestIDHeader))
 
 			if tt.want.body != "" {
-				assert.Equal(t, tt.want.body, string(body))
+				assert.Equal(t, tt.want.body, body)
 			}
 
 			if tt.want.location != "" {
@@ -177,3 +366,391 @@ func TestMux(t *testing.T) {
 		})
 	}
 }
+
+// testBaseURL is base URL of short URLs issued by test server.
+const testBaseURL = "http://localhost:8080"
+
+// testServerOptions configures server started by newTestServer.
+type testServerOptions struct {
+	// rep is MapDB when nil.
+	rep store.Repository
+	// flushInterval of deleter, default one when zero.
+	flushInterval time.Duration
+	norm          urlnorm.Options
+	pol           *policy.Policy
+}
+
+// testServer is shortener server which issues sequential short IDs starting
+// from 000000 and signs cookies with test secret.
+type testServer struct {
+	*httptest.Server
+	t      *testing.T
+	rep    store.Repository
+	h      *handlers.Handler
+	signer *middleware.CookieSigner
+}
+
+// newTestServer starts server stopped when test finishes.
+func newTestServer(t *testing.T, opts testServerOptions) *testServer {
+	t.Helper()
+
+	cfg := config.Config{
+		BaseURL:   testBaseURL,
+		SecretKey: "secret",
+	}
+	if opts.rep == nil {
+		opts.rep = store.NewMapDB()
+	}
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	del := deleter.New(opts.rep, 0, opts.flushInterval)
+	t.Cleanup(del.Close)
+	h := handlers.New(opts.rep, del, nil, cfg.BaseURL, gen, "", opts.norm, opts.pol)
+
+	ts := httptest.NewServer(routes.New(h, &cfg, nil))
+	t.Cleanup(ts.Close)
+
+	return &testServer{
+		Server: ts,
+		t:      t,
+		rep:    opts.rep,
+		h:      h,
+		signer: middleware.NewCookieSigner(cfg.SecretKey, nil),
+	}
+}
+
+// do sends request with body on behalf of user, anonymous one when userID is
+// empty, and returns response with read body.
+func (s *testServer) do(method, path, body, userID string) (*http.Response, string) {
+	s.t.Helper()
+
+	req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+	require.NoError(s.t, err)
+	return s.send(req, userID)
+}
+
+// send sends req like do, redirects are not followed.
+func (s *testServer) send(req *http.Request, userID string) (*http.Response, string) {
+	s.t.Helper()
+
+	if userID != "" {
+		req.AddCookie(&http.Cookie{Name: middleware.UserIDCookie, Value: s.signer.Sign(userID)})
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	require.NoError(s.t, err)
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	require.NoError(s.t, err)
+	return resp, string(b)
+}
+
+func TestDeletionJob(t *testing.T) {
+	ts := newTestServer(t, testServerOptions{flushInterval: 10 * time.Millisecond})
+
+	resp, _ := ts.do(http.MethodPost, "/", "https://practicum.yandex.ru", "owner")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp, _ = ts.do(http.MethodPost, "/", "https://practicum-1.yandex.ru", "other")
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, body := ts.do(http.MethodDelete, "/api/user/urls", `["000000", "000001", "unknown"]`, "owner")
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	location := resp.Header.Get("Location")
+	require.True(t, strings.HasPrefix(location, "/api/user/jobs/"))
+	jobID := strings.TrimPrefix(location, "/api/user/jobs/")
+	assert.Equal(t, fmt.Sprintf(`{"job_id":"%s"}`, jobID), body)
+
+	resp, _ = ts.do(http.MethodGet, location, "", "other")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	wantResults := `"results":[{"id":"000000","status":"deleted"},{"id":"000001","status":"not_owner"},{"id":"unknown","status":"not_found"}]`
+	assert.Eventually(t, func() bool {
+		resp, body = ts.do(http.MethodGet, location, "", "owner")
+		return resp.StatusCode == http.StatusOK && strings.Contains(body, `"status":"done"`)
+	}, time.Second, 10*time.Millisecond)
+	assert.Contains(t, body, wantResults)
+
+	resp, _ = ts.do(http.MethodGet, "/000000", "", "owner")
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	resp, body = ts.do(http.MethodPost, "/api/user/urls/restore", `["000000"]`, "other")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"restored":[]}`, body)
+
+	resp, body = ts.do(http.MethodPost, "/api/user/urls/restore", `["000000", "000001", "unknown"]`, "owner")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"restored":["000000"]}`, body)
+	url, err := ts.rep.Get(context.Background(), "000000")
+	require.NoError(t, err)
+	assert.Equal(t, "https://practicum.yandex.ru", url)
+
+	resp, _ = ts.do(http.MethodPost, "/api/user/urls/restore", `not json`, "owner")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestExpiredLink(t *testing.T) {
+	ts := newTestServer(t, testServerOptions{})
+
+	require.NoError(t, ts.rep.Set(context.Background(), store.Record{
+		ID:        "expired",
+		URL:       "https://practicum.yandex.ru",
+		UserID:    "owner",
+		Canonical: "https://practicum.yandex.ru",
+		ExpiresAt: time.Now(),
+	}))
+	resp, _ := ts.do(http.MethodGet, "/expired", "", "owner")
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	_, err := ts.rep.ArchiveExpired(context.Background(), time.Now())
+	require.NoError(t, err)
+	resp, _ = ts.do(http.MethodGet, "/expired", "", "owner")
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	// URL of expired link is shortened again with new ID
+	resp, body := ts.do(http.MethodPost, "/", "https://practicum.yandex.ru", "owner")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, testBaseURL+"/000000", body)
+}
+
+// failingBatch is repository which can not save batches.
+type failingBatch struct {
+	*store.MapDB
+}
+
+func (failingBatch) SetBatch(context.Context, []store.Record) ([]store.SetResult, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestShortenStreamUncompressed(t *testing.T) {
+	// more than one chunk, but less than server reads ahead before response
+	const n = 600
+	var body bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&body, `{"correlation_id":"%d","original_url":"https://practicum-%d.yandex.ru/%s"}`+"\n",
+			i, i, strings.Repeat("a", 300))
+	}
+	require.Less(t, body.Len(), 256<<10)
+
+	post := func(t *testing.T, rep store.Repository) []map[string]interface{} {
+		ts := newTestServer(t, testServerOptions{rep: rep})
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/shorten/stream", bytes.NewReader(body.Bytes()))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", handlers.NDJSONContentType)
+		resp, out := ts.send(req, "")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var results []map[string]interface{}
+		dec := json.NewDecoder(strings.NewReader(out))
+		for dec.More() {
+			var res map[string]interface{}
+			require.NoError(t, dec.Decode(&res))
+			results = append(results, res)
+		}
+		return results
+	}
+
+	t.Run("saved", func(t *testing.T) {
+		results := post(t, store.NewMapDB())
+		require.Len(t, results, n)
+		for i, res := range results {
+			assert.Equal(t, strconv.Itoa(i), res["correlation_id"])
+			assert.NotEmpty(t, res["short_url"])
+			assert.Nil(t, res["error"])
+		}
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		// every line of failed chunk gets error, the rest is not processed
+		results := post(t, failingBatch{MapDB: store.NewMapDB()})
+		require.Len(t, results, 500)
+		for i, res := range results {
+			assert.Equal(t, strconv.Itoa(i), res["correlation_id"])
+			assert.Equal(t, map[string]interface{}{"code": "internal", "message": "connection refused"}, res["error"])
+		}
+	})
+}
+
+func TestProbes(t *testing.T) {
+	ts := newTestServer(t, testServerOptions{})
+
+	resp, body := ts.do(http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `{"status":"ok"}`, body)
+
+	resp, body = ts.do(http.MethodGet, "/readyz", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"status":"ok","draining":false,"storage":{"status":"ok","storage":"memory"},"delete_queue":{"status":"ok","length":0,"saturation":0}}`, body)
+
+	ts.h.Drain()
+	resp, body = ts.do(http.MethodGet, "/readyz", "", "")
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Contains(t, body, `"status":"fail","draining":true`)
+
+	resp, _ = ts.do(http.MethodGet, "/healthz", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestShortenStream(t *testing.T) {
+	ts := newTestServer(t, testServerOptions{})
+
+	// more lines than one chunk with invalid ones in the middle
+	const n = 1200
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	for i := 0; i < n; i++ {
+		switch i {
+		case 700:
+			fmt.Fprintln(zw, `{"correlation_id":`)
+		case 701:
+			fmt.Fprintln(zw)
+			fmt.Fprintln(zw, `{"correlation_id":"bad","original_url":"not url"}`)
+		default:
+			fmt.Fprintf(zw, `{"correlation_id":"%d","original_url":"https://practicum-%d.yandex.ru"}`+"\n", i, i)
+		}
+	}
+	require.NoError(t, zw.Close())
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/shorten/stream", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", handlers.NDJSONContentType)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, out := ts.send(req, "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, handlers.NDJSONContentType, resp.Header.Get("Content-Type"))
+
+	type result struct {
+		CorrelationID string `json:"correlation_id"`
+		ShortURL      string `json:"short_url"`
+		Error         *struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	var results []result
+	dec := json.NewDecoder(strings.NewReader(out))
+	for dec.More() {
+		var res result
+		require.NoError(t, dec.Decode(&res))
+		results = append(results, res)
+	}
+	require.Len(t, results, n)
+	assert.Equal(t, result{CorrelationID: "0", ShortURL: testBaseURL + "/000000"}, results[0])
+	require.NotNil(t, results[700].Error)
+	assert.Equal(t, "invalid_json", results[700].Error.Code)
+	require.NotNil(t, results[701].Error)
+	assert.Equal(t, "bad", results[701].CorrelationID)
+	assert.Equal(t, "invalid_url", results[701].Error.Code)
+	assert.Equal(t, "1199", results[n-1].CorrelationID)
+	assert.NotEmpty(t, results[n-1].ShortURL)
+
+	urls, err := ts.rep.CountURLs(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, n-2, urls)
+
+	req, err = http.NewRequest(http.MethodPost, ts.URL+"/api/shorten/stream", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, _ = ts.send(req, "")
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func TestSameURLOfUsers(t *testing.T) {
+	ts := newTestServer(t, testServerOptions{})
+
+	resp, body := ts.do(http.MethodPost, "/", "https://practicum.yandex.ru", "first")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, testBaseURL+"/000000", body)
+
+	// the same user gets existing link with conflict
+	resp, body = ts.do(http.MethodPost, "/api/shorten", `{"url":"https://practicum.yandex.ru"}`, "first")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, `{"result":"http://localhost:8080/000000"}`, body)
+
+	// another user gets own link, ID 000001 is spent by the conflict
+	resp, body = ts.do(http.MethodPost, "/", "https://practicum.yandex.ru", "second")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, testBaseURL+"/000002", body)
+	resp, body = ts.do(http.MethodPost, "/", "https://practicum.yandex.ru", "second")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, testBaseURL+"/000002", body)
+
+	resp, body = ts.do(http.MethodGet, "/api/user/urls", "", "second")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `[{"short_url":"http://localhost:8080/000002","original_url":"https://practicum.yandex.ru"}]`, body)
+}
+
+func TestCanonicalURL(t *testing.T) {
+	for _, keep := range []bool{false, true} {
+		ts := newTestServer(t, testServerOptions{norm: urlnorm.Options{StripTracking: true, KeepOriginal: keep}})
+
+		resp, body := ts.do(http.MethodPost, "/api/shorten", `{"url":"HTTPS://Practicum.Yandex.ru:443/a?utm_source=x"}`, "owner")
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		var first struct {
+			Result string `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &first))
+
+		// the same user submits equivalent URL
+		resp, body = ts.do(http.MethodPost, "/", "https://practicum.yandex.ru/a?", "owner")
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, first.Result, body)
+
+		url, err := ts.rep.Get(context.Background(), strings.TrimPrefix(first.Result, testBaseURL+"/"))
+		require.NoError(t, err)
+		if keep {
+			assert.Equal(t, "HTTPS://Practicum.Yandex.ru:443/a?utm_source=x", url)
+		} else {
+			assert.Equal(t, "https://practicum.yandex.ru/a", url)
+		}
+	}
+}
+
+func TestURLPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains")
+	require.NoError(t, os.WriteFile(path, []byte("deny evil.com\n"), 0644))
+	pol, err := policy.New(nil, testBaseURL, path, 0)
+	require.NoError(t, err)
+	ts := newTestServer(t, testServerOptions{pol: pol})
+
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{url: "javascript:alert(1)", rule: policy.RuleScheme},
+		{url: "http://localhost:8080/000000", rule: policy.RuleOwnHost},
+		{url: "https://www.Evil.com/a", rule: policy.RuleDomainBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			body, err := json.Marshal(map[string]string{"url": tt.url})
+			require.NoError(t, err)
+			for _, req := range []struct{ path, body string }{
+				{path: "/", body: tt.url},
+				{path: "/api/shorten", body: string(body)},
+			} {
+				resp, body := ts.do(http.MethodPost, req.path, req.body, "")
+				var out struct {
+					Error struct {
+						Code string `json:"code"`
+						Rule string `json:"rule"`
+					} `json:"error"`
+				}
+				require.NoError(t, json.Unmarshal([]byte(body), &out))
+				assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode, req.path)
+				assert.Equal(t, "policy_violation", out.Error.Code, req.path)
+				assert.Equal(t, tt.rule, out.Error.Rule, req.path)
+			}
+		})
+	}
+
+	resp, body := ts.do(http.MethodPost, "/api/shorten/batch",
+		`[{"correlation_id":"1","original_url":"https://evil.com/"},{"correlation_id":"2","original_url":"https://practicum.yandex.ru/"}]`, "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.JSONEq(t, `[
+		{"correlation_id":"1","error":{"code":"policy_violation","rule":"domain_blocked","message":"url violates policy: domain evil.com is blocked"}},
+		{"correlation_id":"2","short_url":"http://localhost:8080/000000"}
+	]`, body)
+}
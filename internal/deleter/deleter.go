@@ -0,0 +1,274 @@
+// Package deleter deletes short URLs in background with batched repository calls.
+package deleter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/store"
+)
+
+const (
+	// DefaultBatchSize used when batch size is not configured.
+	DefaultBatchSize = 100
+	// DefaultFlushInterval used when flush interval is not configured.
+	DefaultFlushInterval = time.Second
+	// JobTTL is how long finished jobs are kept.
+	JobTTL = time.Hour
+)
+
+// Job statuses.
+const (
+	JobPending = "pending"
+	JobDone    = "done"
+)
+
+// StatusPending is status of URL which is not processed yet.
+const StatusPending store.DeleteStatus = "pending"
+
+var (
+	// ErrClosed returned when URLs are queued after Close.
+	ErrClosed = errors.New("deleter is closed")
+	// ErrJobNotFound returned for unknown job or job of another user.
+	ErrJobNotFound = errors.New("deletion job not found")
+)
+
+// Job describes deletion of URLs requested by user at once.
+type Job struct {
+	ID         string
+	UserID     string
+	Status     string
+	Results    []ItemResult
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// ItemResult is outcome of deletion of one short URL.
+type ItemResult struct {
+	ID     string
+	Status store.DeleteStatus
+}
+
+// job is Job being processed, pending is number of unprocessed URLs.
+type job struct {
+	Job
+	pending int
+}
+
+// jobItem is URL queued for deletion, idx is its position in job results.
+type jobItem struct {
+	store.DeleteItem
+	job *job
+	idx int
+}
+
+// Deleter buffers URLs to be deleted and flushes them to repository when
+// batch is full or flush interval passed. Outcome of every request is kept
+// as Job for JobTTL after it finished.
+type Deleter struct {
+	queued atomic.Int64
+
+	rep      store.Repository
+	size     int
+	interval time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	input  chan jobItem
+	done   chan struct{}
+
+	jobsMu sync.Mutex
+	jobs   map[string]*job
+}
+
+// New create Deleter and start its worker. Close must be called to flush buffered URLs.
+func New(rep store.Repository, size int, interval time.Duration) *Deleter {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+
+	d := &Deleter{
+		rep:      rep,
+		size:     size,
+		interval: interval,
+		input:    make(chan jobItem, size),
+		done:     make(chan struct{}),
+		jobs:     make(map[string]*job),
+	}
+	go d.run()
+	return d
+}
+
+// Delete queues short URLs of user for deletion and returns ID of created job.
+func (d *Deleter) Delete(userID string, ids []string) (string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.closed {
+		return "", ErrClosed
+	}
+
+	jobID, err := newJobID()
+	if err != nil {
+		return "", err
+	}
+	j := &job{
+		Job: Job{
+			ID:        jobID,
+			UserID:    userID,
+			Status:    JobPending,
+			Results:   make([]ItemResult, len(ids)),
+			CreatedAt: time.Now(),
+		},
+		pending: len(ids),
+	}
+	for i, id := range ids {
+		j.Results[i] = ItemResult{ID: id, Status: StatusPending}
+	}
+	if len(ids) == 0 {
+		j.Status = JobDone
+		j.FinishedAt = j.CreatedAt
+	}
+
+	d.jobsMu.Lock()
+	d.jobs[jobID] = j
+	d.jobsMu.Unlock()
+
+	d.queued.Add(int64(len(ids)))
+	for i, id := range ids {
+		d.input <- jobItem{DeleteItem: store.DeleteItem{URLID: id, UserID: userID}, job: j, idx: i}
+	}
+	return jobID, nil
+}
+
+// Job returns copy of deletion job of user.
+func (d *Deleter) Job(userID, jobID string) (Job, error) {
+	d.jobsMu.Lock()
+	defer d.jobsMu.Unlock()
+
+	j, ok := d.jobs[jobID]
+	if !ok || j.UserID != userID {
+		return Job{}, ErrJobNotFound
+	}
+	res := j.Job
+	res.Results = append([]ItemResult(nil), j.Results...)
+	return res, nil
+}
+
+// QueueLen returns number of URLs queued for deletion and not flushed yet.
+func (d *Deleter) QueueLen() int {
+	return int(d.queued.Load())
+}
+
+// Saturation returns fill ratio of input buffer, Delete blocks until URLs are
+// flushed when it is 1.
+func (d *Deleter) Saturation() float64 {
+	return float64(len(d.input)) / float64(cap(d.input))
+}
+
+// Close stops accepting URLs and waits until buffered ones are flushed.
+func (d *Deleter) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.input)
+	}
+	d.mu.Unlock()
+
+	<-d.done
+}
+
+func (d *Deleter) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	batch := make([]jobItem, 0, d.size)
+	for {
+		select {
+		case item, ok := <-d.input:
+			if !ok {
+				d.flush(batch)
+				logger.Log.Info("stop deleting URLs")
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) >= d.size {
+				d.flush(batch)
+				batch = batch[:0]
+			}
+		case now := <-ticker.C:
+			d.flush(batch)
+			batch = batch[:0]
+			d.removeFinished(now.Add(-JobTTL))
+		}
+	}
+}
+
+func (d *Deleter) flush(batch []jobItem) {
+	if len(batch) == 0 {
+		return
+	}
+
+	items := make([]store.DeleteItem, 0, len(batch))
+	for _, item := range batch {
+		items = append(items, item.DeleteItem)
+	}
+	statuses, err := d.rep.DeleteBatch(context.Background(), items)
+	if err != nil {
+		logger.Log.Error("failed to delete URLs", zap.Int("count", len(batch)), zap.Error(err))
+	} else {
+		logger.Log.Debug("URLs processed for deletion", zap.Int("count", len(batch)))
+	}
+
+	d.queued.Add(-int64(len(batch)))
+
+	now := time.Now()
+	d.jobsMu.Lock()
+	defer d.jobsMu.Unlock()
+	for i, item := range batch {
+		status := store.DeleteStatusError
+		if err == nil {
+			status = statuses[i]
+		}
+		j := item.job
+		j.Results[item.idx].Status = status
+		j.pending--
+		if j.pending == 0 {
+			j.Status = JobDone
+			j.FinishedAt = now
+		}
+	}
+}
+
+// removeFinished forgets jobs finished before t.
+func (d *Deleter) removeFinished(t time.Time) {
+	d.jobsMu.Lock()
+	defer d.jobsMu.Unlock()
+
+	for id, j := range d.jobs {
+		if j.Status == JobDone && j.FinishedAt.Before(t) {
+			delete(d.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
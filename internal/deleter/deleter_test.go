@@ -0,0 +1,111 @@
+package deleter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paramonies/internal/store"
+)
+
+// batchRecorder records batches passed to DeleteBatch.
+type batchRecorder struct {
+	*store.MapDB
+	mu      sync.Mutex
+	batches [][]store.DeleteItem
+}
+
+func (r *batchRecorder) DeleteBatch(ctx context.Context, items []store.DeleteItem) ([]store.DeleteStatus, error) {
+	r.mu.Lock()
+	r.batches = append(r.batches, append([]store.DeleteItem(nil), items...))
+	r.mu.Unlock()
+	return r.MapDB.DeleteBatch(ctx, items)
+}
+
+func (r *batchRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.batches)
+}
+
+func newRecorder(t *testing.T, ids ...string) *batchRecorder {
+	rep := &batchRecorder{MapDB: store.NewMapDB()}
+	for _, id := range ids {
+		require.NoError(t, rep.Set(context.Background(), store.Record{ID: id, URL: "https://" + id + ".ru", UserID: "user"}))
+	}
+	return rep
+}
+
+func TestDeleterFlushBySize(t *testing.T) {
+	rep := newRecorder(t, "a", "b", "c")
+	d := New(rep, 2, time.Hour)
+
+	_, err := d.Delete("user", []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return rep.count() == 1 }, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return d.QueueLen() == 1 }, time.Second, time.Millisecond)
+
+	// the rest is flushed on close
+	d.Close()
+	assert.Equal(t, 0, d.QueueLen())
+	assert.Zero(t, d.Saturation())
+	require.Equal(t, 2, rep.count())
+	assert.Len(t, rep.batches[0], 2)
+	assert.Equal(t, []store.DeleteItem{{URLID: "c", UserID: "user"}}, rep.batches[1])
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := rep.Get(context.Background(), id)
+		assert.ErrorIs(t, err, store.ErrGone)
+	}
+}
+
+func TestDeleterFlushByInterval(t *testing.T) {
+	rep := newRecorder(t, "a")
+	d := New(rep, 100, 10*time.Millisecond)
+	defer d.Close()
+
+	_, err := d.Delete("user", []string{"a"})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := rep.Get(context.Background(), "a")
+		return err != nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestDeleterClosed(t *testing.T) {
+	d := New(newRecorder(t), 0, 0)
+	d.Close()
+	_, err := d.Delete("user", []string{"a"})
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestDeleterJob(t *testing.T) {
+	rep := newRecorder(t, "a", "b")
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "c", URL: "https://c.ru", UserID: "other"}))
+	d := New(rep, 100, time.Hour)
+
+	jobID, err := d.Delete("user", []string{"a", "c", "unknown"})
+	require.NoError(t, err)
+
+	job, err := d.Job("user", jobID)
+	require.NoError(t, err)
+	assert.Equal(t, JobPending, job.Status)
+	assert.Equal(t, ItemResult{ID: "a", Status: StatusPending}, job.Results[0])
+
+	_, err = d.Job("other", jobID)
+	assert.ErrorIs(t, err, ErrJobNotFound)
+
+	d.Close()
+	job, err = d.Job("user", jobID)
+	require.NoError(t, err)
+	assert.Equal(t, JobDone, job.Status)
+	assert.Equal(t, []ItemResult{
+		{ID: "a", Status: store.DeleteStatusDeleted},
+		{ID: "c", Status: store.DeleteStatusNotOwner},
+		{ID: "unknown", Status: store.DeleteStatusNotFound},
+	}, job.Results)
+}
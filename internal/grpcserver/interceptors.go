@@ -0,0 +1,98 @@
+package grpcserver
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/middleware"
+)
+
+// UserIDMetadata is metadata key with signed user ID, the same value as in user_id cookie.
+const UserIDMetadata = "user_id"
+
+// RequestIDMetadata is metadata key with request ID, it is taken from call
+// metadata when valid and always sent back in header.
+const RequestIDMetadata = "x-request-id"
+
+// LoggingInterceptor puts logger with request ID and method in call context
+// and logs every unary call with its duration and status code.
+func LoggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadata); len(values) > 0 && middleware.ValidRequestID(values[0]) {
+			requestID = values[0]
+		}
+	}
+	if requestID == "" {
+		requestID = middleware.NewRequestID()
+	}
+	ctx = middleware.WithRequestID(ctx, requestID)
+	l := logger.FromContext(ctx).With(zap.String("method", info.FullMethod))
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, requestID)); err != nil {
+		l.Error("failed to set header", zap.String("metadata", RequestIDMetadata), zap.Error(err))
+	}
+	ctx = logger.WithLogger(ctx, l)
+
+	resp, err := handler(ctx, req)
+
+	fields := []zap.Field{zap.Stringer("code", status.Code(err)), zap.Duration("duration", time.Since(start))}
+	switch status.Code(err) {
+	case codes.OK:
+		l.Info("gRPC call", fields...)
+	case codes.Internal, codes.Unknown, codes.Unavailable:
+		l.Error("gRPC call", append(fields, zap.Error(err))...)
+	default:
+		l.Info("gRPC call", append(fields, zap.Error(err))...)
+	}
+	return resp, err
+}
+
+// AuthInterceptor puts user ID from signed user_id metadata in call context.
+// New signed user ID is sent back in user_id header when metadata is absent,
+// fails verification or signed with previous key.
+func AuthInterceptor(signer *middleware.CookieSigner) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var userID string
+		rotated := false
+
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(UserIDMetadata); len(values) > 0 {
+				var err error
+				userID, rotated, err = signer.Verify(values[0])
+				if err != nil {
+					logger.FromContext(ctx).Info("failed to verify metadata",
+						zap.String("metadata", UserIDMetadata), zap.Error(err))
+				}
+			}
+		}
+
+		if userID == "" {
+			var err error
+			userID, err = middleware.GenerateToken(10)
+			if err != nil {
+				logger.FromContext(ctx).Error("failed to generate user id",
+					zap.String("metadata", UserIDMetadata), zap.Error(err))
+				return handler(ctx, req)
+			}
+			rotated = true
+		}
+
+		if rotated {
+			header := metadata.Pairs(UserIDMetadata, signer.Sign(userID))
+			if err := grpc.SetHeader(ctx, header); err != nil {
+				logger.FromContext(ctx).Error("failed to set header",
+					zap.String("metadata", UserIDMetadata), zap.Error(err))
+			}
+		}
+
+		return handler(middleware.WithUserID(ctx, userID), req)
+	}
+}
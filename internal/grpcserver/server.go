@@ -0,0 +1,284 @@
+// Package grpcserver implements gRPC API of the service on top of handlers.Handler.
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/handlers"
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/policy"
+	"github.com/paramonies/internal/store"
+	pb "github.com/paramonies/proto"
+)
+
+// Server implements pb.ShortenerServer.
+type Server struct {
+	pb.UnimplementedShortenerServer
+	h       *handlers.Handler
+	subnets middleware.TrustedSubnets
+	proxies middleware.TrustedSubnets
+}
+
+// New create gRPC server with logging and auth interceptors.
+// Internal statistics are available only for clients from subnets.
+// X-Real-IP metadata is trusted only when it is sent by one of proxies.
+func New(h *handlers.Handler, signer *middleware.CookieSigner, subnets, proxies middleware.TrustedSubnets) *grpc.Server {
+	s := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		LoggingInterceptor,
+		AuthInterceptor(signer),
+	))
+	pb.RegisterShortenerServer(s, &Server{h: h, subnets: subnets, proxies: proxies})
+	return s
+}
+
+func (s *Server) Shorten(ctx context.Context, in *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	req := handlers.ShortenRequest{
+		URL:        in.Url,
+		UserID:     userID,
+		Alias:      in.Alias,
+		TTLSeconds: in.TtlSeconds,
+	}
+	if in.ExpiresAt != nil {
+		t := in.ExpiresAt.AsTime()
+		req.ExpiresAt = &t
+	}
+
+	shortURL, err := s.h.Shorten(ctx, req)
+	if errors.Is(err, store.ErrConstraintViolation) {
+		return &pb.ShortenResponse{Result: shortURL, Conflict: true}, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ShortenResponse{Result: shortURL}, nil
+}
+
+func (s *Server) ShortenBatch(ctx context.Context, in *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	items := make([]handlers.BatchItem, 0, len(in.Items))
+	for _, item := range in.Items {
+		req := handlers.ShortenRequest{
+			URL:        item.OriginalUrl,
+			Alias:      item.Alias,
+			TTLSeconds: item.TtlSeconds,
+		}
+		if item.ExpiresAt != nil {
+			t := item.ExpiresAt.AsTime()
+			req.ExpiresAt = &t
+		}
+		items = append(items, handlers.BatchItem{CorrelationID: item.CorrelationId, ShortenRequest: req})
+	}
+
+	results, err := s.h.ShortenBatch(ctx, userID, items)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ShortenBatchResponse{Items: make([]*pb.BatchResult, 0, len(results))}
+	for _, res := range results {
+		item := &pb.BatchResult{CorrelationId: res.CorrelationID, ShortUrl: res.ShortURL}
+		if res.Err != nil {
+			item.ErrorCode = handlers.ErrorCode(res.Err)
+			item.Error = res.Err.Error()
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	return resp, nil
+}
+
+func (s *Server) Expand(ctx context.Context, in *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	v := handlers.Visit{IP: clientIP(ctx, s.proxies)}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ua := md.Get("user-agent"); len(ua) > 0 {
+			v.UserAgent = ua[0]
+		}
+		if ref := md.Get("referer"); len(ref) > 0 {
+			v.Referrer = ref[0]
+		}
+	}
+
+	originalURL, err := s.h.Expand(ctx, in.Id, v)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.ExpandResponse{OriginalUrl: originalURL}, nil
+}
+
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	list, err := s.h.UserURLs(ctx, userID)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.ListUserURLsResponse{Urls: make([]*pb.UserURL, 0, len(list))}
+	for _, u := range list {
+		resp.Urls = append(resp.Urls, &pb.UserURL{ShortUrl: u.ShortURL, OriginalUrl: u.OriginalURL})
+	}
+	return resp, nil
+}
+
+func (s *Server) GetURLStats(ctx context.Context, in *pb.GetURLStatsRequest) (*pb.GetURLStatsResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	stats, err := s.h.URLStats(ctx, userID, in.Id)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.GetURLStatsResponse{
+		ShortUrl:       s.h.ShortURL(in.Id),
+		Clicks:         stats.Clicks,
+		UniqueVisitors: stats.UniqueVisitors,
+		Daily:          make([]*pb.DayStats, 0, len(stats.Daily)),
+	}
+	for _, day := range stats.Daily {
+		resp.Daily = append(resp.Daily, &pb.DayStats{
+			Date:           day.Date,
+			Clicks:         day.Clicks,
+			UniqueVisitors: day.UniqueVisitors,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) DeleteUserURLs(ctx context.Context, in *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	jobID, err := s.h.DeleteUserURLs(userID, in.Ids)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.DeleteUserURLsResponse{JobId: jobID}, nil
+}
+
+func (s *Server) GetDeletionJob(ctx context.Context, in *pb.GetDeletionJobRequest) (*pb.GetDeletionJobResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	job, err := s.h.DeletionJob(userID, in.JobId)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	resp := &pb.GetDeletionJobResponse{
+		JobId:     job.ID,
+		Status:    job.Status,
+		CreatedAt: timestamppb.New(job.CreatedAt),
+		Results:   make([]*pb.DeletionResult, 0, len(job.Results)),
+	}
+	if !job.FinishedAt.IsZero() {
+		resp.FinishedAt = timestamppb.New(job.FinishedAt)
+	}
+	for _, res := range job.Results {
+		resp.Results = append(resp.Results, &pb.DeletionResult{Id: res.ID, Status: string(res.Status)})
+	}
+	return resp, nil
+}
+
+func (s *Server) RestoreUserURLs(ctx context.Context, in *pb.RestoreUserURLsRequest) (*pb.RestoreUserURLsResponse, error) {
+	userID, err := middleware.UserIDFromContext(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	restored, err := s.h.RestoreUserURLs(ctx, userID, in.Ids)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.RestoreUserURLsResponse{Ids: restored}, nil
+}
+
+func (s *Server) Ping(ctx context.Context, _ *pb.PingRequest) (*pb.PingResponse, error) {
+	if err := s.h.CheckStorage(ctx); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.PingResponse{}, nil
+}
+
+func (s *Server) GetInternalStats(ctx context.Context, _ *pb.InternalStatsRequest) (*pb.InternalStatsResponse, error) {
+	ip := clientIP(ctx, s.proxies)
+	if !s.subnets.Contains(ip) {
+		return nil, status.Errorf(codes.PermissionDenied, "ip %q is not in trusted subnet", ip)
+	}
+
+	urls, users, err := s.h.InternalStats(ctx)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &pb.InternalStatsResponse{Urls: int64(urls), Users: int64(users)}, nil
+}
+
+// statusError converts service errors to gRPC status errors.
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, handlers.ErrInvalidURL),
+		errors.Is(err, handlers.ErrInvalidAlias), errors.Is(err, handlers.ErrReservedAlias),
+		errors.Is(err, handlers.ErrExpiryConflict), errors.Is(err, handlers.ErrInvalidExpiry),
+		errors.Is(err, policy.ErrViolation):
+		code = codes.InvalidArgument
+	case errors.Is(err, handlers.ErrAliasTaken), errors.Is(err, store.ErrConstraintViolation):
+		code = codes.AlreadyExists
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, handlers.ErrURLNotFound),
+		errors.Is(err, deleter.ErrJobNotFound):
+		code = codes.NotFound
+	case errors.Is(err, store.ErrGone):
+		code = codes.FailedPrecondition
+	}
+	return status.Error(code, err.Error())
+}
+
+// clientIP returns address of connection peer, or address from X-Real-IP
+// metadata when peer is one of trusted proxies.
+func clientIP(ctx context.Context, proxies middleware.TrustedSubnets) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+	if !proxies.Contains(host) {
+		return host
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ip := md.Get("x-real-ip"); len(ip) > 0 {
+			return ip[0]
+		}
+	}
+	return host
+}
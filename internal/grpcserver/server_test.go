@@ -0,0 +1,157 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/handlers"
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/shortid"
+	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/urlnorm"
+	pb "github.com/paramonies/proto"
+)
+
+func TestServer(t *testing.T) {
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	rep := store.NewMapDB()
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := handlers.New(rep, del, nil, "http://localhost:8080", gen, "", urlnorm.Options{}, nil)
+	signer := middleware.NewCookieSigner("secret", nil)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	subnets, err := middleware.ParseTrustedSubnets("10.0.0.0/8")
+	require.NoError(t, err)
+	proxies, err := middleware.ParseTrustedSubnets("127.0.0.0/8")
+	require.NoError(t, err)
+	s := New(h, signer, subnets, proxies)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewShortenerClient(conn)
+	ctx := context.Background()
+
+	// first call issues user ID
+	var header metadata.MD
+	resp, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://practicum.yandex.ru"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/000000", resp.Result)
+	require.Len(t, header.Get(UserIDMetadata), 1)
+	assert.Len(t, header.Get(RequestIDMetadata), 1)
+
+	userCtx := metadata.AppendToOutgoingContext(ctx, UserIDMetadata, header.Get(UserIDMetadata)[0])
+
+	header = nil
+	resp, err = client.Shorten(metadata.AppendToOutgoingContext(userCtx, RequestIDMetadata, "test"),
+		&pb.ShortenRequest{Url: "https://practicum-1.yandex.ru", Alias: "spring-sale"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/spring-sale", resp.Result)
+	assert.Equal(t, []string{"test"}, header.Get(RequestIDMetadata))
+
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "https://practicum-2.yandex.ru", Alias: "spring-sale"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = client.Shorten(userCtx, &pb.ShortenRequest{Url: "123"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	expanded, err := client.Expand(ctx, &pb.ExpandRequest{Id: "spring-sale"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://practicum-1.yandex.ru", expanded.OriginalUrl)
+
+	_, err = client.Expand(ctx, &pb.ExpandRequest{Id: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListUserURLs(userCtx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.Urls, 2)
+	assert.Equal(t, "http://localhost:8080/000000", list.Urls[0].ShortUrl)
+	assert.Equal(t, "http://localhost:8080/spring-sale", list.Urls[1].ShortUrl)
+
+	stats, err := client.GetURLStats(userCtx, &pb.GetURLStatsRequest{Id: "spring-sale"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Clicks)
+
+	// another user does not see links
+	list, err = client.ListUserURLs(ctx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Empty(t, list.Urls)
+
+	batch, err := client.ShortenBatch(userCtx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "first", OriginalUrl: "https://practicum-3.yandex.ru"},
+		{CorrelationId: "second", OriginalUrl: "https://practicum-4.yandex.ru"},
+		{CorrelationId: "invalid", OriginalUrl: "not url"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.Items, 3)
+	assert.Equal(t, "first", batch.Items[0].CorrelationId)
+	assert.NotEmpty(t, batch.Items[1].ShortUrl)
+	assert.Empty(t, batch.Items[2].ShortUrl)
+	assert.Equal(t, "invalid_url", batch.Items[2].ErrorCode)
+
+	_, err = client.Ping(ctx, &pb.PingRequest{})
+	assert.NoError(t, err)
+
+	_, err = client.GetInternalStats(ctx, &pb.InternalStatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	trustedCtx := metadata.AppendToOutgoingContext(ctx, "x-real-ip", "10.1.2.3")
+	internal, err := client.GetInternalStats(trustedCtx, &pb.InternalStatsRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), internal.Urls)
+	assert.Equal(t, int64(1), internal.Users)
+
+	deleted, err := client.DeleteUserURLs(userCtx, &pb.DeleteUserURLsRequest{Ids: []string{"000000", "unknown"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, deleted.JobId)
+
+	_, err = client.GetDeletionJob(ctx, &pb.GetDeletionJobRequest{JobId: deleted.JobId})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	job, err := client.GetDeletionJob(userCtx, &pb.GetDeletionJobRequest{JobId: deleted.JobId})
+	require.NoError(t, err)
+	require.Len(t, job.Results, 2)
+	assert.Equal(t, "000000", job.Results[0].Id)
+}
+
+func TestInternalStatsSpoofedIP(t *testing.T) {
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	rep := store.NewMapDB()
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := handlers.New(rep, del, nil, "http://localhost:8080", gen, "", urlnorm.Options{}, nil)
+	signer := middleware.NewCookieSigner("secret", nil)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	subnets, err := middleware.ParseTrustedSubnets("10.0.0.0/8")
+	require.NoError(t, err)
+	// peer is not a trusted proxy, so x-real-ip must be ignored
+	s := New(h, signer, subnets, nil)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewShortenerClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-real-ip", "10.1.2.3")
+	_, err = client.GetInternalStats(ctx, &pb.InternalStatsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 64
+)
+
+var (
+	// ErrInvalidAlias returned when alias has wrong length or symbols.
+	ErrInvalidAlias = fmt.Errorf("alias must be %d-%d symbols of latin letters, digits, '-' or '_'",
+		minAliasLength, maxAliasLength)
+	// ErrReservedAlias returned when alias clashes with service routes.
+	ErrReservedAlias = errors.New("alias is reserved")
+	// ErrAliasTaken returned when alias is already used by another short URL.
+	ErrAliasTaken = errors.New("alias is already taken")
+
+	// ReservedAliases contains first path segments of service routes.
+	ReservedAliases = []string{"api", "debug", "ping", "healthz", "readyz"}
+
+	aliasRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+func validateAlias(alias string) error {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength || !aliasRe.MatchString(alias) {
+		return ErrInvalidAlias
+	}
+
+	for _, reserved := range ReservedAliases {
+		if strings.EqualFold(alias, reserved) {
+			return fmt.Errorf("%s: %w", alias, ErrReservedAlias)
+		}
+	}
+	return nil
+}
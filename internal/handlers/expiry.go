@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrExpiryConflict returned when both expires_at and ttl_seconds are set.
+	ErrExpiryConflict = errors.New("only one of expires_at and ttl_seconds can be set")
+	// ErrInvalidExpiry returned when link expiration is not in the future.
+	ErrInvalidExpiry = errors.New("link expiration must be in the future")
+)
+
+// expiryTime returns moment of link expiration defined by absolute expiresAt
+// or ttlSeconds from now. Zero time means link never expires.
+func expiryTime(expiresAt *time.Time, ttlSeconds int64, now time.Time) (time.Time, error) {
+	if expiresAt != nil && ttlSeconds != 0 {
+		return time.Time{}, ErrExpiryConflict
+	}
+
+	switch {
+	case expiresAt != nil:
+		if !expiresAt.After(now) {
+			return time.Time{}, ErrInvalidExpiry
+		}
+		return expiresAt.UTC(), nil
+	case ttlSeconds < 0:
+		return time.Time{}, ErrInvalidExpiry
+	case ttlSeconds > 0:
+		return now.Add(time.Duration(ttlSeconds) * time.Second).UTC(), nil
+	}
+	return time.Time{}, nil
+}
@@ -2,142 +2,162 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
-	"net/url"
-	"sort"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/policy"
+	"github.com/paramonies/internal/shortid"
 	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/urlnorm"
 )
 
-const workersCount = 10
+// maxGenerateAttempts limits attempts of generator which may repeat short IDs.
+const maxGenerateAttempts = 5
+
+// ErrNoFreeID returned when generator gives only already used short IDs.
+var ErrNoFreeID = errors.New("failed to generate unique short id")
+
+// ClickRecorder records redirects by short URLs.
+type ClickRecorder interface {
+	AddClick(ctx context.Context, c store.Click) error
+}
 
 // Handler contains common info for handler methods.
 type Handler struct {
-	rep store.Repository
-	url string
+	rep    store.Repository
+	del    *deleter.Deleter
+	clicks ClickRecorder
+	url    string
+	gen    shortid.IDGenerator
+	ipSalt string
+	norm   urlnorm.Options
+	pol    *policy.Policy
+	// draining is set to 1 by Drain when shutdown begins
+	draining int32
 }
 
-// New create new Handler.
-func New(rep store.Repository, url string) *Handler {
-	return &Handler{rep, url}
+// New create new Handler. del deletes URLs in background. clicks records
+// redirects, they are written to rep when it is nil. ipSalt is mixed into
+// hashes of client IP addresses stored with clicks. norm defines canonical form
+// of URLs used for duplicate detection. pol checks destination URLs, any URL
+// is accepted when it is nil.
+func New(rep store.Repository, del *deleter.Deleter, clicks ClickRecorder, url string, gen shortid.IDGenerator,
+	ipSalt string, norm urlnorm.Options, pol *policy.Policy) *Handler {
+	if clicks == nil {
+		clicks = rep
+	}
+	return &Handler{rep: rep, del: del, clicks: clicks, url: url, gen: gen, ipSalt: ipSalt, norm: norm, pol: pol}
 }
 
 // CreateShortURL create short URL for Post text/plain
 func (h *Handler) CreateShortURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("create short url from text/plain body")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("create short url from text/plain body")
 
 		b, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Printf("request body: %s", string(b))
 
 		urlStr := string(b)
-		log.Printf("original url: %s", urlStr)
-		_, err = url.ParseRequestURI(urlStr)
-		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+		log.Debug("original url", logger.URL("original_url", urlStr))
 
-		id := Hash(urlStr)
-		log.Printf("hash for url: %d", id)
-		cookie, err := r.Cookie("user_id")
-		if errors.Is(err, http.ErrNoCookie) {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("cookie: %s=%s", cookie.Name, cookie.Value)
-
-		shortURL := fmt.Sprintf("%s/%d", h.url, id)
-		log.Printf("short url: %s", shortURL)
 
-		err = h.rep.Set(fmt.Sprintf("%d", id), urlStr, cookie.Value)
+		shortURL, err := h.Shorten(r.Context(), ShortenRequest{URL: urlStr, UserID: userID})
 		if err != nil {
-			log.Printf("error: %v", err)
+			log.Info("failed to shorten url", zap.Error(err))
 			if errors.Is(err, store.ErrConstraintViolation) {
 				w.Header().Set("Content-Type", "application/json; charset=utf-8")
 				w.WriteHeader(http.StatusConflict)
 				w.Write([]byte(shortURL))
 				return
 			}
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			if writePolicyViolation(w, r, err) {
+				return
+			}
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		log.Println("save url info in repository")
-
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusCreated)
 		w.Write([]byte(shortURL))
 
-		log.Printf("response body: %s", shortURL)
-		log.Println("short url from text/plain body created")
+		log.Debug("short url from text/plain body created", zap.String("short_url", shortURL))
 	}
 }
 
 // CreateShortURLFromJSON create short URL for Post JSON request.
 func (h *Handler) CreateShortURLFromJSON() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("create short URL from JSON")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("create short URL from JSON")
 
 		b, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		log.Printf("request body: %s", string(b))
 
 		var reqBodyJSON struct {
-			URL string `json:"url"`
+			URL        string     `json:"url"`
+			Alias      string     `json:"alias,omitempty"`
+			ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+			TTLSeconds int64      `json:"ttl_seconds,omitempty"`
 		}
 		err = json.Unmarshal(b, &reqBodyJSON)
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		URL := reqBodyJSON.URL
-		log.Printf("original url from JSON: %s", URL)
-		_, err = url.ParseRequestURI(URL)
+		log.Debug("original url from JSON", logger.URL("original_url", reqBodyJSON.URL))
+
+		userID, err := middleware.UserIDFromContext(r.Context())
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		id := Hash(URL)
-		log.Printf("hash for url: %d", id)
-
-		cookie, err := r.Cookie("user_id")
-		if errors.Is(err, http.ErrNoCookie) {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		shortURL, errSet := h.Shorten(r.Context(), ShortenRequest{
+			URL:        reqBodyJSON.URL,
+			UserID:     userID,
+			Alias:      reqBodyJSON.Alias,
+			ExpiresAt:  reqBodyJSON.ExpiresAt,
+			TTLSeconds: reqBodyJSON.TTLSeconds,
+		})
+		if status := requestErrorStatus(errSet); status != 0 {
+			log.Info("failed to shorten url", zap.Error(errSet))
+			if writePolicyViolation(w, r, errSet) {
+				return
+			}
+			middleware.Error(w, r, errSet.Error(), status)
 			return
 		}
-		log.Printf("cookie: %s=%s", cookie.Name, cookie.Value)
-
-		shortURL := fmt.Sprintf("%s/%d", h.url, id)
-		log.Printf("short url: %s", shortURL)
-
-		errSet := h.rep.Set(fmt.Sprintf("%d", id), URL, cookie.Value)
 
 		resBodyJSON := struct {
 			Result string `json:"result"`
@@ -147,213 +167,336 @@ func (h *Handler) CreateShortURLFromJSON() http.HandlerFunc {
 
 		resBody, err := json.Marshal(resBodyJSON)
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		if errSet != nil {
-			log.Printf("error: %v", errSet)
+			log.Info("failed to shorten url", zap.Error(errSet))
 			if errors.Is(errSet, store.ErrConstraintViolation) {
 				w.Header().Set("Content-Type", "application/json; charset=utf-8")
 				w.WriteHeader(http.StatusConflict)
 				w.Write(resBody)
 				return
 			}
-			http.Error(w, errSet.Error(), http.StatusBadRequest)
+			middleware.Error(w, r, errSet.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Println("save url info in repository")
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(http.StatusCreated)
 		w.Write(resBody)
 
-		log.Printf("response body: %s", string(resBody))
-		log.Println("short URL from JSON created")
+		log.Debug("short URL from JSON created", zap.String("short_url", shortURL))
 	}
 }
 
+// batchInput is JSON of one URL of batch to be shortened.
+type batchInput struct {
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	Alias         string     `json:"alias,omitempty"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int64      `json:"ttl_seconds,omitempty"`
+}
+
+func (in batchInput) batchItem() BatchItem {
+	return BatchItem{
+		CorrelationID: in.CorrelationID,
+		ShortenRequest: ShortenRequest{
+			URL:        in.OriginalURL,
+			Alias:      in.Alias,
+			ExpiresAt:  in.ExpiresAt,
+			TTLSeconds: in.TTLSeconds,
+		},
+	}
+}
+
+// batchOutput is JSON of result of one URL of batch.
+type batchOutput struct {
+	CorrelationID string       `json:"correlation_id"`
+	ShortURL      string       `json:"short_url,omitempty"`
+	Error         *outputError `json:"error,omitempty"`
+}
+
+// outputError is JSON of request error, Rule is set for policy violations.
+type outputError struct {
+	Code    string `json:"code"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func newOutputError(err error) *outputError {
+	out := &outputError{Code: ErrorCode(err), Message: err.Error()}
+	var v *policy.Violation
+	if errors.As(err, &v) {
+		out.Rule = v.Rule
+	}
+	return out
+}
+
+func newBatchOutput(res BatchResult) batchOutput {
+	out := batchOutput{CorrelationID: res.CorrelationID, ShortURL: res.ShortURL}
+	if res.Err != nil {
+		out.Error = newOutputError(res.Err)
+	}
+	return out
+}
+
+// writePolicyViolation writes 422 response with violated rule when err is
+// policy violation and reports whether it did.
+func writePolicyViolation(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, policy.ErrViolation) {
+		return false
+	}
+
+	resBody, errMarshal := json.Marshal(struct {
+		Error     *outputError `json:"error"`
+		RequestID string       `json:"request_id,omitempty"`
+	}{
+		Error:     newOutputError(err),
+		RequestID: middleware.RequestIDFromContext(r.Context()),
+	})
+	if errMarshal != nil {
+		middleware.Error(w, r, errMarshal.Error(), http.StatusInternalServerError)
+		return true
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	w.Write(resBody)
+	return true
+}
+
 // CreateManyShortURL create many URL for POST request with many json records.
 func (h *Handler) CreateManyShortURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("create many short URLs from JSON")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("create many short URLs from JSON")
 
 		b, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
-		log.Printf("request body: %s", string(b))
 
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		type inputData struct {
-			CorrelationID string `json:"correlation_id"`
-			OriginalURL   string `json:"original_url"`
-		}
-
-		var inputJSON []inputData
+		var inputJSON []batchInput
 		err = json.Unmarshal(b, &inputJSON)
 		if err != nil {
 			msg := fmt.Sprintf("failed to unmarshal JSON: %s", err.Error())
-			log.Println(msg)
-			http.Error(w, msg, http.StatusBadRequest)
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, msg, http.StatusBadRequest)
 			return
 		}
 
-		cookie, err := r.Cookie("user_id")
-		if errors.Is(err, http.ErrNoCookie) {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("cookie: %s=%s", cookie.Name, cookie.Value)
 
-		data := make(map[string]string)
+		items := make([]BatchItem, 0, len(inputJSON))
 		for _, row := range inputJSON {
-			URL := row.OriginalURL
-			_, err = url.ParseRequestURI(URL)
-			if err != nil {
-				msg := fmt.Sprintf("id %s not found", err.Error())
-				log.Println(msg)
-				http.Error(w, msg, http.StatusBadRequest)
-				return
-			}
-
-			id := Hash(URL)
-			log.Printf("\thash %d for URL %s", id, URL)
-			err := h.rep.Set(fmt.Sprintf("%d", id), URL, cookie.Value)
-			if err != nil {
-				log.Printf("error: %v", err)
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			shortURL := fmt.Sprintf("%s/%d", h.url, id)
-			data[row.CorrelationID] = shortURL
-
-			log.Printf("\tshort url %s for original %s saved in repository", shortURL, URL)
+			items = append(items, row.batchItem())
 		}
 
-		type outputData struct {
-			CorrelationID string `json:"correlation_id"`
-			ShortURL      string `json:"short_url"`
+		results, err := h.ShortenBatch(r.Context(), userID, items)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		var outputJSON []outputData
-
-		keys := make([]string, 0, len(data))
-		for k := range data {
-			keys = append(keys, k)
+		status := http.StatusBadRequest
+		if len(results) == 0 {
+			status = http.StatusCreated
 		}
-		sort.Strings(keys)
-
-		for _, k := range keys {
-			outputJSON = append(outputJSON, outputData{CorrelationID: k, ShortURL: data[k]})
+		outputJSON := make([]batchOutput, 0, len(results))
+		for _, res := range results {
+			if res.Err == nil {
+				status = http.StatusCreated
+			}
+			outputJSON = append(outputJSON, newBatchOutput(res))
 		}
 
 		resBody, err := json.Marshal(outputJSON)
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(status)
 		w.Write(resBody)
 
-		log.Printf("response body: %s", string(resBody))
-		log.Println("list of short URLs from JSON created")
+		log.Debug("list of short URLs from JSON created")
 	}
 }
 
 // GetURLByID get original URL by ID.
 func (h *Handler) GetURLByID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("get original URL by short ID")
+		log := middleware.Logger(r)
+		log.Debug("get original URL by short ID")
 		id := chi.URLParam(r, "ID")
-		log.Printf("request url: %s %s", r.Method, r.URL)
 
-		val, err := h.rep.Get(id)
+		val, err := h.Expand(r.Context(), id, Visit{
+			Referrer:  r.Referer(),
+			UserAgent: r.UserAgent(),
+			IP:        clientIP(r),
+		})
 		if err != nil {
-			log.Printf("error: %v", err)
+			log.Info("failed to expand short url", zap.String("id", id), zap.Error(err))
 
 			if errors.Is(err, store.ErrGone) {
-				http.Error(w, err.Error(), http.StatusGone)
+				middleware.Error(w, r, err.Error(), http.StatusGone)
 				return
 			}
 
-			http.Error(w, "id not found", http.StatusBadRequest)
+			middleware.Error(w, r, "id not found", http.StatusBadRequest)
 			return
 		}
-		log.Printf("load original url from repository: %s", val)
 
 		http.Redirect(w, r, val, http.StatusTemporaryRedirect)
 		w.Write([]byte("ID found"))
 
-		log.Printf("original url %s for id %s found", val, id)
+		log.Debug("original url found", zap.String("id", id), logger.URL("original_url", val))
+	}
+}
+
+// GetURLStats get click statistics for short URL of user.
+func (h *Handler) GetURLStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("get click statistics for short URL")
+		id := chi.URLParam(r, "ID")
+
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		stats, err := h.URLStats(r.Context(), userID, id)
+		if err != nil {
+			if errors.Is(err, ErrURLNotFound) {
+				log.Info("short url not found", zap.String("id", id), zap.Error(err))
+				middleware.Error(w, r, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resBodyJSON := struct {
+			ShortURL string `json:"short_url"`
+			store.Stats
+		}{
+			ShortURL: h.ShortURL(id),
+			Stats:    stats,
+		}
+
+		resBody, err := json.Marshal(resBodyJSON)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resBody)
+
+		log.Debug("click statistics for short URL loaded", zap.String("id", id))
+	}
+}
+
+// GetInternalStats get total number of shortened URLs and users in service.
+func (h *Handler) GetInternalStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("get internal service statistics")
+
+		urls, users, err := h.InternalStats(r.Context())
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resBodyJSON := struct {
+			URLs  int `json:"urls"`
+			Users int `json:"users"`
+		}{
+			URLs:  urls,
+			Users: users,
+		}
+
+		resBody, err := json.Marshal(resBodyJSON)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resBody)
+
+		log.Debug("internal statistics loaded", zap.Int("urls", urls), zap.Int("users", users))
 	}
 }
 
 // GetListByUserID get all saved URLs for user ID.
 func (h *Handler) GetListByUserID() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("get list URLs for userID")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("get list URLs for userID")
 
-		cookie, err := r.Cookie("user_id")
+		userID, err := middleware.UserIDFromContext(r.Context())
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("cookie: %s=%s", cookie.Name, cookie.Value)
 
-		userID := cookie.Value
-		list, err := h.rep.GetAllByID(userID)
+		list, err := h.UserURLs(r.Context(), userID)
 
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		if len(list) == 0 {
 			msg := fmt.Sprintf("No content for user with id %s", userID)
-			log.Printf("No content for user with id %s", userID)
-			http.Error(w, msg, http.StatusNoContent)
+			log.Debug("no short urls of user")
+			middleware.Error(w, r, msg, http.StatusNoContent)
 			return
 		}
 
-		log.Printf("load list URLs for userID %s from repository", userID)
-
 		type data struct {
 			ShortURL string `json:"short_url"`
 			OrigURL  string `json:"original_url"`
 		}
 
 		var listURL []data
-
-		keys := make([]string, 0, len(list))
-		for k := range list {
-			keys = append(keys, k)
-		}
-		sort.Strings(keys)
-
-		for _, k := range keys {
-			val := list[k]
-			shortURL := fmt.Sprintf("%s/%s", h.url, k)
-			listURL = append(listURL, data{ShortURL: shortURL, OrigURL: val})
-			log.Printf("\t %s %s", shortURL, val)
+		for _, u := range list {
+			listURL = append(listURL, data{ShortURL: u.ShortURL, OrigURL: u.OriginalURL})
 		}
 
 		listB, err := json.Marshal(listURL)
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -361,54 +504,83 @@ func (h *Handler) GetListByUserID() http.HandlerFunc {
 		w.WriteHeader(http.StatusOK)
 		w.Write(listB)
 
-		log.Printf("response body: %s", string(listB))
-		log.Printf("loaded list URLs for userID %s", userID)
+		log.Debug("list URLs of user loaded", zap.Int("count", len(listURL)))
 	}
 }
 
 // Ping verify service work.
 func (h *Handler) Ping() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("ping database")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("ping database")
 
-		err := h.rep.Ping()
+		err := h.CheckStorage(r.Context())
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 
-		log.Println("database is connected")
+		log.Debug("database is connected")
 	}
 }
 
-type item struct {
-	URLID  string
-	UserID string
+// requestErrorStatus returns HTTP status for errors caused by invalid create
+// request or 0 for other errors.
+func requestErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidURL),
+		errors.Is(err, ErrInvalidAlias), errors.Is(err, ErrReservedAlias),
+		errors.Is(err, ErrExpiryConflict), errors.Is(err, ErrInvalidExpiry):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAliasTaken):
+		return http.StatusConflict
+	case errors.Is(err, policy.ErrViolation):
+		return http.StatusUnprocessableEntity
+	}
+	return 0
 }
 
-type errorItem struct {
-	item
-	Err error
+// ErrorCode returns machine readable code of service error.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrInvalidURL):
+		return "invalid_url"
+	case errors.Is(err, ErrInvalidAlias):
+		return "invalid_alias"
+	case errors.Is(err, ErrReservedAlias):
+		return "reserved_alias"
+	case errors.Is(err, ErrAliasTaken):
+		return "alias_taken"
+	case errors.Is(err, ErrExpiryConflict):
+		return "expiry_conflict"
+	case errors.Is(err, ErrInvalidExpiry):
+		return "invalid_expiry"
+	case errors.Is(err, ErrNoFreeID):
+		return "no_free_id"
+	case errors.Is(err, ErrInvalidJSON):
+		return "invalid_json"
+	case errors.Is(err, policy.ErrViolation):
+		return "policy_violation"
+	}
+	return "internal"
 }
 
 // DeleteManyShortURL delete many short URLs for User by IDs.
 func (h *Handler) DeleteManyShortURL() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Println("delete many short URLs")
-		log.Printf("request url: %s %s", r.Method, r.URL)
+		log := middleware.Logger(r)
+		log.Debug("delete many short URLs")
 
 		b, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
-		log.Printf("request body: %s", string(b))
 
 		if err != nil {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
@@ -416,57 +588,167 @@ func (h *Handler) DeleteManyShortURL() http.HandlerFunc {
 		err = json.Unmarshal(b, &ids)
 		if err != nil {
 			msg := fmt.Sprintf("failed to unmarshal JSON: %s", err.Error())
-			log.Println(msg)
-			http.Error(w, msg, http.StatusBadRequest)
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, msg, http.StatusBadRequest)
 			return
 		}
 
-		cookie, err := r.Cookie("user_id")
-		if errors.Is(err, http.ErrNoCookie) {
-			log.Printf("error: %v", err)
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("cookie: %s=%s", cookie.Name, cookie.Value)
 
-		go execDelete(ids, cookie.Value, h.rep)
+		jobID, err := h.DeleteUserURLs(userID, ids)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 
-		resBody := "urls deleted"
+		resBodyJSON := struct {
+			JobID string `json:"job_id"`
+		}{
+			JobID: jobID,
+		}
+
+		resBody, err := json.Marshal(resBodyJSON)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("Location", "/api/user/jobs/"+jobID)
 		w.WriteHeader(http.StatusAccepted)
-		w.Write([]byte(resBody))
+		w.Write(resBody)
 
-		log.Printf("response body: %s", resBody)
-		log.Println(resBody)
+		log.Debug("deletion job created", zap.String("job_id", jobID), zap.Int("count", len(ids)))
 	}
 }
 
-func execDelete(ids []string, userID string, rep store.Repository) {
-	log.Println("async deleting many short URLs")
-	inputCh := make(chan item)
+// GetDeletionJob get status of deletion job of user.
+func (h *Handler) GetDeletionJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("get deletion job")
+		jobID := chi.URLParam(r, "jobID")
 
-	go func() {
-		for _, id := range ids {
-			inputCh <- item{URLID: id, UserID: userID}
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
 		}
-		close(inputCh)
-	}()
 
-	fanOutChs := fanOut(inputCh, workersCount)
+		job, err := h.DeletionJob(userID, jobID)
+		if err != nil {
+			if errors.Is(err, deleter.ErrJobNotFound) {
+				log.Info("deletion job not found", zap.String("job_id", jobID))
+				middleware.Error(w, r, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		type itemResult struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		}
+		resBodyJSON := struct {
+			JobID      string       `json:"job_id"`
+			Status     string       `json:"status"`
+			CreatedAt  time.Time    `json:"created_at"`
+			FinishedAt *time.Time   `json:"finished_at,omitempty"`
+			Results    []itemResult `json:"results"`
+		}{
+			JobID:     job.ID,
+			Status:    job.Status,
+			CreatedAt: job.CreatedAt.UTC(),
+			Results:   make([]itemResult, 0, len(job.Results)),
+		}
+		if !job.FinishedAt.IsZero() {
+			finishedAt := job.FinishedAt.UTC()
+			resBodyJSON.FinishedAt = &finishedAt
+		}
+		for _, res := range job.Results {
+			resBodyJSON.Results = append(resBodyJSON.Results, itemResult{ID: res.ID, Status: string(res.Status)})
+		}
 
-	workerChs := make([]chan errorItem, 0, workersCount)
-	for _, fanOutCh := range fanOutChs {
-		workerCh := newWorker(fanOutCh, rep)
-		workerChs = append(workerChs, workerCh)
+		resBody, err := json.Marshal(resBodyJSON)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resBody)
+
+		log.Debug("deletion job loaded", zap.String("job_id", jobID), zap.String("status", job.Status))
 	}
+}
+
+// RestoreShortURLs restore deleted short URLs of user.
+func (h *Handler) RestoreShortURLs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("restore short URLs")
+
+		b, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var ids []string
+		err = json.Unmarshal(b, &ids)
+		if err != nil {
+			msg := fmt.Sprintf("failed to unmarshal JSON: %s", err.Error())
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, msg, http.StatusBadRequest)
+			return
+		}
+
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-	for errItem := range fanIn(workerChs...) {
-		var msg string
-		if errItem.Err != nil {
-			msg = fmt.Sprintf("Error deleting URL: %v", errItem.Err)
-		} else {
-			msg = "URL deleted"
+		restored, err := h.RestoreUserURLs(r.Context(), userID, ids)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
 		}
-		log.Printf("short URL: %s, user: %s, msg: %s", errItem.URLID, errItem.UserID, msg)
+
+		resBodyJSON := struct {
+			Restored []string `json:"restored"`
+		}{
+			Restored: restored,
+		}
+
+		resBody, err := json.Marshal(resBodyJSON)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(resBody)
+
+		log.Debug("short URLs restored", zap.Int("count", len(restored)))
 	}
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -11,9 +12,18 @@ import (
 	"testing"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/paramonies/internal/config"
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/logger"
 	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/shortid"
+	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/urlnorm"
 )
 
 func BenchmarkCreateShortURL(b *testing.B) {
@@ -25,19 +35,22 @@ func BenchmarkCreateShortURL(b *testing.B) {
 		BaseURL: "http://localhost:8080",
 	}
 
-	rep, err := config.NewRepository(&cfg)
+	rep, err := config.NewRepository(&cfg, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rep.Close()
-	h := New(rep, cfg.BaseURL)
 
-	userID, _ := middleware.GenerateToken(10)
-	cookie := &http.Cookie{
-		Name:   "user_id",
-		Value:  userID,
-		Secure: false,
+	gen, err := config.NewIDGenerator(&cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, cfg.BaseURL, gen, cfg.AnalyticsSalt, urlnorm.Options{}, nil)
+
+	userID, _ := middleware.GenerateToken(10)
+	ctx := middleware.WithUserID(context.Background(), userID)
 
 	b.ResetTimer() // reset all timers
 	for i := 0; i < b.N; i++ {
@@ -45,7 +58,7 @@ func BenchmarkCreateShortURL(b *testing.B) {
 		st := "http://test_link_" + strconv.Itoa(i) + ".ru"
 		r = strings.NewReader(st)
 		request := httptest.NewRequest(http.MethodPost, "/", r)
-		request.AddCookie(cookie)
+		request = request.WithContext(ctx)
 		b.StartTimer() //
 		rtr.HandleFunc("/", h.CreateShortURL())
 		// запускаем сервер
@@ -66,36 +79,44 @@ func BenchmarkHandler_GetURLByID(b *testing.B) {
 		BaseURL: "http://localhost:8080",
 	}
 
-	rep, err := config.NewRepository(&cfg)
+	rep, err := config.NewRepository(&cfg, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rep.Close()
-	h := New(rep, cfg.BaseURL)
 
-	userID, _ := middleware.GenerateToken(10)
-	cookie := &http.Cookie{
-		Name:   "user_id",
-		Value:  userID,
-		Secure: false,
+	gen, err := config.NewIDGenerator(&cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, cfg.BaseURL, gen, cfg.AnalyticsSalt, urlnorm.Options{}, nil)
+
+	userID, _ := middleware.GenerateToken(10)
+	ctx := middleware.WithUserID(context.Background(), userID)
 
 	// add url in repository
 	st := "http://test_link.ru"
 	r = strings.NewReader(st)
 	request := httptest.NewRequest(http.MethodPost, "/", r)
-	request.AddCookie(cookie)
+	request = request.WithContext(ctx)
 	rtr.HandleFunc("/", h.CreateShortURL())
 	rtr.ServeHTTP(w, request)
 	res := w.Result()
 	res.Body.Close()
-	fmt.Println(rep.GetAllByID(userID))
+	list, _ := rep.GetAllByID(ctx, userID)
+	fmt.Println(list)
+
+	var tg string
+	for id := range list {
+		tg = "/" + id
+	}
 
 	b.ResetTimer() // reset all timers
 
 	for i := 0; i < b.N; i++ {
 		b.StopTimer() // stop all timers
-		tg := "/1133590167"
 		request := httptest.NewRequest(http.MethodGet, tg, r)
 
 		b.StartTimer() //
@@ -119,30 +140,33 @@ func BenchmarkHandler_GetListByUserID(b *testing.B) {
 		BaseURL: "http://localhost:8080",
 	}
 
-	rep, err := config.NewRepository(&cfg)
+	rep, err := config.NewRepository(&cfg, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rep.Close()
-	h := New(rep, cfg.BaseURL)
 
-	userID, _ := middleware.GenerateToken(10)
-	cookie := &http.Cookie{
-		Name:   "user_id",
-		Value:  userID,
-		Secure: false,
+	gen, err := config.NewIDGenerator(&cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, cfg.BaseURL, gen, cfg.AnalyticsSalt, urlnorm.Options{}, nil)
+
+	userID, _ := middleware.GenerateToken(10)
+	ctx := middleware.WithUserID(context.Background(), userID)
 
 	// add url in repository
 	st := "http://test_link.ru"
 	r = strings.NewReader(st)
 	request := httptest.NewRequest(http.MethodPost, "/", r)
-	request.AddCookie(cookie)
+	request = request.WithContext(ctx)
 	rtr.HandleFunc("/", h.CreateShortURL())
 	rtr.ServeHTTP(w, request)
 	res := w.Result()
 	res.Body.Close()
-	fmt.Println(rep.GetAllByID(userID))
+	fmt.Println(rep.GetAllByID(ctx, userID))
 
 	b.ResetTimer() // reset all timers
 
@@ -150,7 +174,7 @@ func BenchmarkHandler_GetListByUserID(b *testing.B) {
 		b.StopTimer() // stop all timers
 
 		request := httptest.NewRequest(http.MethodGet, "/api/user/urls", r)
-		request.AddCookie(cookie)
+		request = request.WithContext(ctx)
 		b.StartTimer() //
 		rtr.HandleFunc("/api/user/urls", h.GetListByUserID())
 		// запускаем сервер
@@ -170,19 +194,22 @@ func BenchmarkHandler_CreateShortURLFromJSON(b *testing.B) {
 		BaseURL: "http://localhost:8080",
 	}
 
-	rep, err := config.NewRepository(&cfg)
+	rep, err := config.NewRepository(&cfg, nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer rep.Close()
-	h := New(rep, cfg.BaseURL)
 
-	userID, _ := middleware.GenerateToken(10)
-	cookie := &http.Cookie{
-		Name:   "user_id",
-		Value:  userID,
-		Secure: false,
+	gen, err := config.NewIDGenerator(&cfg)
+	if err != nil {
+		log.Fatal(err)
 	}
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, cfg.BaseURL, gen, cfg.AnalyticsSalt, urlnorm.Options{}, nil)
+
+	userID, _ := middleware.GenerateToken(10)
+	ctx := middleware.WithUserID(context.Background(), userID)
 
 	b.ResetTimer() // reset all timers
 	for i := 0; i < b.N; i++ {
@@ -190,7 +217,7 @@ func BenchmarkHandler_CreateShortURLFromJSON(b *testing.B) {
 		st := "{\"url\": \"http://test_link_" + strconv.Itoa(i) + ".ru\"}"
 		r = strings.NewReader(st)
 		request := httptest.NewRequest(http.MethodPost, "/api/shorten", r)
-		request.AddCookie(cookie)
+		request = request.WithContext(ctx)
 		b.StartTimer() //
 		rtr.HandleFunc("/api/shorten", h.CreateShortURLFromJSON())
 		// запускаем сервер
@@ -202,3 +229,69 @@ func BenchmarkHandler_CreateShortURLFromJSON(b *testing.B) {
 		res.Body.Close()
 	}
 }
+
+func TestURLNotLogged(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	defer func(l *zap.Logger) { logger.Log = l }(logger.Log)
+	logger.Log = zap.New(core)
+
+	rep := store.NewMapDB()
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, "http://localhost:8080", gen, "", urlnorm.Options{}, nil)
+
+	rtr := chi.NewRouter()
+	rtr.Post("/", h.CreateShortURL())
+	rtr.Post("/api/shorten", h.CreateShortURLFromJSON())
+	rtr.Post("/api/shorten/batch", h.CreateManyShortURL())
+
+	const secret = "s3cr3t"
+	requests := []struct {
+		path   string
+		body   string
+		status int
+	}{
+		{path: "/", body: "https://practicum.yandex.ru/?token=" + secret, status: http.StatusCreated},
+		{path: "/", body: "https://practicum.yandex.ru/?token=" + secret, status: http.StatusConflict},
+		{path: "/", body: "not url?token=" + secret, status: http.StatusBadRequest},
+		{path: "/api/shorten", body: `{"url":"http://a b/?token=` + secret + `"}`, status: http.StatusBadRequest},
+		{path: "/api/shorten/batch", body: `[{"correlation_id":"1","original_url":"not url?token=` + secret + `"},{"correlation_id":"2","original_url":"https://ya.ru/?token=` + secret + `"}]`, status: http.StatusCreated},
+	}
+
+	ctx := middleware.WithUserID(context.Background(), "user")
+	for _, req := range requests {
+		r := httptest.NewRequest(http.MethodPost, req.path, strings.NewReader(req.body)).WithContext(ctx)
+		w := httptest.NewRecorder()
+		rtr.ServeHTTP(w, r)
+		assert.Equal(t, req.status, w.Code, req.body)
+	}
+
+	require.NotEmpty(t, logs.All())
+	for _, entry := range logs.All() {
+		assert.NotContains(t, entry.Message, secret)
+		for key, value := range entry.ContextMap() {
+			assert.NotContains(t, fmt.Sprint(value), secret, "field %s of %q", key, entry.Message)
+		}
+	}
+}
+
+func TestSequentialIDsUsedBeforeRestart(t *testing.T) {
+	ctx := context.Background()
+	rep := store.NewMapDB()
+	for i := 0; i < 2*maxGenerateAttempts; i++ {
+		require.NoError(t, rep.Set(ctx, store.Record{ID: fmt.Sprintf("%06d", i), URL: fmt.Sprintf("https://%d.ru", i), UserID: "user"}))
+	}
+
+	// counter restarted from the first ID skips all used IDs
+	gen, err := shortid.NewCounter(shortid.Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	del := deleter.New(rep, 0, 0)
+	defer del.Close()
+	h := New(rep, del, nil, "http://localhost:8080", gen, "", urlnorm.Options{}, nil)
+
+	shortURL, err := h.Shorten(ctx, ShortenRequest{URL: "https://practicum.yandex.ru", UserID: "user"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/00000A", shortURL)
+}
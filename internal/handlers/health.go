@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/middleware"
+	"github.com/paramonies/internal/store"
+)
+
+// Statuses of readiness checks.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Readiness describes whether service can serve requests. Status is fail when
+// any check fails or service is draining.
+type Readiness struct {
+	Status      string       `json:"status"`
+	Draining    bool         `json:"draining"`
+	Storage     StorageCheck `json:"storage"`
+	DeleteQueue QueueCheck   `json:"delete_queue"`
+}
+
+// StorageCheck is result of repository health check.
+type StorageCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	store.Health
+}
+
+// QueueCheck describes queue of URLs waiting for deletion. It fails when
+// queue buffer is full and deletion requests are blocked.
+type QueueCheck struct {
+	Status     string  `json:"status"`
+	Length     int     `json:"length"`
+	Saturation float64 `json:"saturation"`
+}
+
+// Drain marks service as not ready, it is called when shutdown begins.
+func (h *Handler) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Ready checks dependencies of service.
+func (h *Handler) Ready(ctx context.Context) Readiness {
+	res := Readiness{Status: StatusOK, Draining: atomic.LoadInt32(&h.draining) == 1}
+	if res.Draining {
+		res.Status = StatusFail
+	}
+
+	health, err := h.rep.Health(ctx)
+	res.Storage = StorageCheck{Status: StatusOK, Health: health}
+	if err != nil {
+		res.Storage.Status, res.Storage.Error = StatusFail, err.Error()
+		res.Status = StatusFail
+	}
+
+	res.DeleteQueue = QueueCheck{Status: StatusOK, Length: h.del.QueueLen(), Saturation: h.del.Saturation()}
+	if res.DeleteQueue.Saturation >= 1 {
+		res.DeleteQueue.Status = StatusFail
+		res.Status = StatusFail
+	}
+	return res
+}
+
+// Healthz reports process is alive, dependencies are not checked.
+func (h *Handler) Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status":"ok"}`))
+	}
+}
+
+// Readyz reports state of dependencies as Readiness, status is 503 when
+// service is not ready.
+func (h *Handler) Readyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("check readiness")
+
+		res := h.Ready(r.Context())
+		resBody, err := json.Marshal(res)
+		if err != nil {
+			log.Error("request failed", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if res.Status != StatusOK {
+			log.Warn("service is not ready", zap.Bool("draining", res.Draining),
+				zap.String("storage_error", res.Storage.Error), zap.Float64("delete_queue_saturation", res.DeleteQueue.Saturation))
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write(resBody)
+	}
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/deleter"
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/shortid"
+	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/urlnorm"
+)
+
+var (
+	// ErrInvalidURL returned when original URL can not be parsed.
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrURLNotFound returned when short URL does not belong to user.
+	ErrURLNotFound = errors.New("short url not found for user")
+)
+
+// ShortenRequest describes URL to be shortened.
+type ShortenRequest struct {
+	URL    string
+	UserID string
+	Alias  string
+	// ExpiresAt and TTLSeconds are mutually exclusive ways to set link expiration.
+	ExpiresAt  *time.Time
+	TTLSeconds int64
+}
+
+// BatchItem describes one URL of batch to be shortened.
+type BatchItem struct {
+	CorrelationID string
+	ShortenRequest
+}
+
+// BatchResult contains short URL for BatchItem with the same CorrelationID
+// or Err when the item is not saved.
+type BatchResult struct {
+	CorrelationID string
+	ShortURL      string
+	Err           error
+}
+
+// UserURL is a pair of short and original URL saved by user.
+type UserURL struct {
+	ShortURL    string
+	OriginalURL string
+}
+
+// Visit describes client followed short URL.
+type Visit struct {
+	Referrer  string
+	UserAgent string
+	IP        string
+}
+
+// Shorten saves URL from req and returns short URL. When URL is already saved
+// it returns short URL of existing record together with store.ErrConstraintViolation.
+func (h *Handler) Shorten(ctx context.Context, req ShortenRequest) (string, error) {
+	rec, err := h.newRecord(req, req.UserID, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	id, err := h.saveURL(ctx, rec)
+	if id == "" {
+		return "", err
+	}
+	return h.ShortURL(id), err
+}
+
+// ShortenBatch saves URLs from items for user with one repository call and
+// returns result of every item in the same order. Already saved URLs get short
+// URL of existing record. Invalid items get error in result, returned error
+// means that repository failed.
+func (h *Handler) ShortenBatch(ctx context.Context, userID string, items []BatchItem) ([]BatchResult, error) {
+	results := make([]BatchResult, len(items))
+	// pending are indexes of items to be saved as recs
+	var pending []int
+	var recs []store.Record
+	now := time.Now()
+	for i, item := range items {
+		results[i].CorrelationID = item.CorrelationID
+
+		rec, err := h.newRecord(item.ShortenRequest, userID, now)
+		if err == nil && item.Alias != "" {
+			err = validateAlias(item.Alias)
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+
+		if rec.ID == "" {
+			if rec.ID, err = h.gen.Generate(); err != nil {
+				return nil, err
+			}
+		}
+		pending = append(pending, i)
+		recs = append(recs, rec)
+	}
+
+	attempts := h.generateAttempts()
+	for attempt := 0; len(recs) > 0; attempt++ {
+		if attempt == attempts {
+			for _, i := range pending {
+				results[i].Err = ErrNoFreeID
+			}
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		saved, err := h.rep.SetBatch(ctx, recs)
+		if err != nil {
+			return nil, err
+		}
+
+		var retry []int
+		var retryRecs []store.Record
+		for j, res := range saved {
+			i := pending[j]
+			switch {
+			case res.Status != store.SetStatusDuplicateID:
+				results[i].ShortURL = h.ShortURL(res.ID)
+			case items[i].Alias != "":
+				results[i].Err = fmt.Errorf("%s: %w", items[i].Alias, ErrAliasTaken)
+			default:
+				logger.FromContext(ctx).Debug("short id is already used, retry", zap.String("id", res.ID))
+				rec := recs[j]
+				if rec.ID, err = h.gen.Generate(); err != nil {
+					return nil, err
+				}
+				retry = append(retry, i)
+				retryRecs = append(retryRecs, rec)
+			}
+		}
+		pending, recs = retry, retryRecs
+	}
+
+	return results, nil
+}
+
+// Expand returns original URL by short ID and records the visit.
+func (h *Handler) Expand(ctx context.Context, id string, v Visit) (string, error) {
+	val, err := h.rep.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+
+	click := store.Click{
+		URLID:     id,
+		Time:      time.Now().UTC(),
+		Referrer:  v.Referrer,
+		UserAgent: v.UserAgent,
+		IPHash:    hashIP(v.IP, h.ipSalt),
+	}
+	if err = h.clicks.AddClick(ctx, click); err != nil {
+		logger.FromContext(ctx).Warn("failed to record click", zap.String("id", id), zap.Error(err))
+	}
+
+	return val, nil
+}
+
+// UserURLs returns all URLs saved by user sorted by short ID.
+func (h *Handler) UserURLs(ctx context.Context, userID string) ([]UserURL, error) {
+	list, err := h.rep.GetAllByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(list))
+	for k := range list {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	urls := make([]UserURL, 0, len(keys))
+	for _, k := range keys {
+		urls = append(urls, UserURL{ShortURL: h.ShortURL(k), OriginalURL: list[k]})
+	}
+	return urls, nil
+}
+
+// URLStats returns click statistics for short URL saved by user.
+func (h *Handler) URLStats(ctx context.Context, userID, id string) (store.Stats, error) {
+	list, err := h.rep.GetAllByID(ctx, userID)
+	if err != nil {
+		return store.Stats{}, err
+	}
+	if _, ok := list[id]; !ok {
+		return store.Stats{}, fmt.Errorf("%s: %w", id, ErrURLNotFound)
+	}
+
+	return h.rep.GetStats(ctx, id)
+}
+
+// DeleteUserURLs queues user short URLs for asynchronous deletion and
+// returns ID of deletion job.
+func (h *Handler) DeleteUserURLs(userID string, ids []string) (string, error) {
+	return h.del.Delete(userID, ids)
+}
+
+// DeletionJob returns deletion job of user.
+func (h *Handler) DeletionJob(userID, jobID string) (deleter.Job, error) {
+	return h.del.Job(userID, jobID)
+}
+
+// RestoreUserURLs restores deleted short URLs of user and returns IDs of
+// restored ones. Unknown IDs, IDs of other users and not deleted IDs are skipped.
+func (h *Handler) RestoreUserURLs(ctx context.Context, userID string, ids []string) ([]string, error) {
+	restored, err := h.rep.Restore(ctx, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if restored == nil {
+		restored = []string{}
+	}
+	return restored, nil
+}
+
+// InternalStats returns total number of shortened URLs and users in service.
+func (h *Handler) InternalStats(ctx context.Context) (urls int, users int, err error) {
+	urls, err = h.rep.CountURLs(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	users, err = h.rep.CountUsers(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	return urls, users, nil
+}
+
+// CheckStorage verifies repository connection.
+func (h *Handler) CheckStorage(ctx context.Context) error {
+	return h.rep.Ping(ctx)
+}
+
+// ShortURL returns short URL for ID.
+func (h *Handler) ShortURL(id string) string {
+	return fmt.Sprintf("%s/%s", h.url, id)
+}
+
+// saveURL stores rec under its ID, which is alias, or newly generated short ID
+// and returns the ID. When URL is already saved it returns ID of existing
+// record together with store.ErrConstraintViolation.
+func (h *Handler) saveURL(ctx context.Context, rec store.Record) (string, error) {
+	if rec.ID != "" {
+		return h.saveAlias(ctx, rec)
+	}
+
+	attempts := h.generateAttempts()
+	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		id, err := h.gen.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		rec.ID = id
+		err = h.rep.Set(ctx, rec)
+		if errors.Is(err, store.ErrDuplicateID) {
+			logger.FromContext(ctx).Debug("short id is already used, retry", zap.String("id", id))
+			continue
+		}
+		return h.checkOriginalConflict(ctx, rec, err)
+	}
+
+	return "", ErrNoFreeID
+}
+
+// generateAttempts returns number of attempts to generate free short ID.
+// Sequential generator is retried until it issues free ID or runs out of IDs,
+// as IDs used before restart or by other instances may take many attempts.
+func (h *Handler) generateAttempts() int {
+	if shortid.IsSequential(h.gen) {
+		return math.MaxInt
+	}
+	return maxGenerateAttempts
+}
+
+func (h *Handler) saveAlias(ctx context.Context, rec store.Record) (string, error) {
+	alias := rec.ID
+	if err := validateAlias(alias); err != nil {
+		return "", err
+	}
+
+	err := h.rep.Set(ctx, rec)
+	if errors.Is(err, store.ErrDuplicateID) {
+		return "", fmt.Errorf("%s: %w", alias, ErrAliasTaken)
+	}
+	return h.checkOriginalConflict(ctx, rec, err)
+}
+
+// checkOriginalConflict returns ID of rec or, when Set failed with
+// store.ErrConstraintViolation, ID of record saved by the same user for the URL.
+func (h *Handler) checkOriginalConflict(ctx context.Context, rec store.Record, err error) (string, error) {
+	if errors.Is(err, store.ErrConstraintViolation) {
+		existID, errGet := h.rep.GetByURL(ctx, rec.UserID, rec.CanonicalURL())
+		if errGet != nil {
+			return "", errGet
+		}
+		return existID, err
+	}
+	if err != nil {
+		return "", err
+	}
+	return rec.ID, nil
+}
+
+// invalidURL wraps ErrInvalidURL with reason of parse error err. URL itself
+// is left out as it may contain secrets in query.
+func invalidURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+}
+
+// newRecord checks URL, its policy and expiration of req and returns record of user to be
+// saved. Record ID is alias of req. Canonical form of URL is saved as record
+// URL unless original URL is kept for redirect.
+func (h *Handler) newRecord(req ShortenRequest, userID string, now time.Time) (store.Record, error) {
+	if _, err := url.ParseRequestURI(req.URL); err != nil {
+		return store.Record{}, invalidURL(err)
+	}
+	canonical, err := urlnorm.Canonicalize(req.URL, h.norm)
+	if err != nil {
+		return store.Record{}, invalidURL(err)
+	}
+	if h.pol != nil {
+		if err = h.pol.Check(canonical); err != nil {
+			return store.Record{}, err
+		}
+	}
+
+	expiresAt, err := expiryTime(req.ExpiresAt, req.TTLSeconds, now)
+	if err != nil {
+		return store.Record{}, err
+	}
+
+	rec := store.Record{ID: req.Alias, URL: canonical, UserID: userID, Canonical: canonical, ExpiresAt: expiresAt}
+	if h.norm.KeepOriginal {
+		rec.URL = req.URL
+	}
+	return rec, nil
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/middleware"
+)
+
+const (
+	// NDJSONContentType is content type of request and response of CreateShortURLStream.
+	NDJSONContentType = "application/x-ndjson"
+	// streamChunkSize is number of stream lines saved with one repository call.
+	streamChunkSize = 500
+	// maxStreamLineSize limits length of one stream line.
+	maxStreamLineSize = 64 * 1024
+)
+
+// ErrInvalidJSON returned for stream line which is not valid batch item.
+var ErrInvalidJSON = errors.New("invalid json")
+
+// streamLine is batch item read from stream or error of its decoding.
+type streamLine struct {
+	item BatchItem
+	err  error
+}
+
+// CreateShortURLStream create short URLs for NDJSON stream of batch items.
+// Body is decoded line by line and saved in chunks, result of every line is
+// written back as NDJSON line in the same order and flushed after every chunk.
+func (h *Handler) CreateShortURLStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log := middleware.Logger(r)
+		log.Debug("create short URLs from NDJSON stream")
+		defer r.Body.Close()
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != NDJSONContentType {
+			msg := fmt.Sprintf("content type must be %s", NDJSONContentType)
+			log.Info("invalid request", zap.String("content_type", r.Header.Get("Content-Type")))
+			middleware.Error(w, r, msg, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		userID, err := middleware.UserIDFromContext(r.Context())
+		if err != nil {
+			log.Info("invalid request", zap.Error(err))
+			middleware.Error(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// results are written while body is read, HTTP/1.1 server closes
+		// unread body on the first flush otherwise
+		if err = http.NewResponseController(w).EnableFullDuplex(); err != nil {
+			log.Debug("full duplex is not supported", zap.Error(err))
+		}
+		w.Header().Set("Content-Type", NDJSONContentType)
+		w.WriteHeader(http.StatusOK)
+
+		s := &resultStream{h: h, r: r, userID: userID, enc: json.NewEncoder(w)}
+		s.flusher, _ = w.(http.Flusher)
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 0, 4096), maxStreamLineSize)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+
+			var in batchInput
+			if err = json.Unmarshal(line, &in); err != nil {
+				s.add(streamLine{err: fmt.Errorf("%w: %v", ErrInvalidJSON, err)})
+			} else {
+				s.add(streamLine{item: in.batchItem()})
+			}
+			if len(s.lines) == streamChunkSize {
+				if err = s.flush(); err != nil {
+					log.Error("failed to save stream chunk", zap.Error(err))
+					return
+				}
+			}
+		}
+		if err = scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				err = fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+			}
+			log.Info("failed to read stream", zap.Error(err))
+			s.add(streamLine{err: err})
+		}
+		if err = s.flush(); err != nil {
+			log.Error("failed to save stream chunk", zap.Error(err))
+			return
+		}
+
+		log.Debug("stream processed", zap.Int("lines", s.total))
+	}
+}
+
+// resultStream saves chunks of stream lines and writes their results.
+type resultStream struct {
+	h       *Handler
+	r       *http.Request
+	userID  string
+	enc     *json.Encoder
+	flusher http.Flusher
+	lines   []streamLine
+	total   int
+}
+
+func (s *resultStream) add(line streamLine) {
+	s.lines = append(s.lines, line)
+}
+
+// flush saves buffered lines and writes their results. Repository error is
+// written as result of every line of the chunk and returned.
+func (s *resultStream) flush() error {
+	if len(s.lines) == 0 {
+		return nil
+	}
+
+	items := make([]BatchItem, 0, len(s.lines))
+	for _, line := range s.lines {
+		if line.err == nil {
+			items = append(items, line.item)
+		}
+	}
+	results, err := s.h.ShortenBatch(s.r.Context(), s.userID, items)
+	if err != nil {
+		for _, line := range s.lines {
+			res := BatchResult{CorrelationID: line.item.CorrelationID, Err: err}
+			if line.err != nil {
+				res.Err = line.err
+			}
+			s.enc.Encode(newBatchOutput(res))
+		}
+		s.flushWriter()
+		return err
+	}
+
+	for _, line := range s.lines {
+		res := BatchResult{Err: line.err}
+		if line.err == nil {
+			res, results = results[0], results[1:]
+		}
+		if err = s.enc.Encode(newBatchOutput(res)); err != nil {
+			return err
+		}
+	}
+	s.flushWriter()
+
+	s.total += len(s.lines)
+	s.lines = s.lines[:0]
+	return nil
+}
+
+func (s *resultStream) flushWriter() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
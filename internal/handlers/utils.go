@@ -1,85 +1,24 @@
 package handlers
 
 import (
-	"hash/fnv"
-	"sync"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
 
-	"github.com/paramonies/internal/store"
+	"github.com/paramonies/internal/middleware"
 )
 
-func fanOut(inputCh chan item, n int) []chan item {
-	chs := make([]chan item, 0, n)
-	for i := 0; i < n; i++ {
-		ch := make(chan item)
-		chs = append(chs, ch)
+// clientIP returns address of client made the request resolved by
+// middleware.RealIP, or address of connection when it is not used.
+func clientIP(r *http.Request) string {
+	if ip := middleware.ClientIPFromContext(r.Context()); ip != "" {
+		return ip
 	}
-
-	go func() {
-		defer func(chs []chan item) {
-			for _, ch := range chs {
-				close(ch)
-			}
-		}(chs)
-
-		for i := 0; ; i++ {
-			if i == len(chs) {
-				i = 0
-			}
-
-			val, ok := <-inputCh
-			if !ok {
-				return
-			}
-
-			ch := chs[i]
-			ch <- val
-		}
-
-	}()
-
-	return chs
-}
-
-func newWorker(inputCh <-chan item, rep store.Repository) chan errorItem {
-	outCh := make(chan errorItem)
-
-	go func() {
-		for item := range inputCh {
-			err := rep.Delete(item.URLID, item.UserID)
-			outCh <- errorItem{item: item, Err: err}
-		}
-		close(outCh)
-	}()
-
-	return outCh
-}
-
-func fanIn(inputChs ...chan errorItem) chan errorItem {
-	outCh := make(chan errorItem)
-
-	go func() {
-		var wg sync.WaitGroup
-
-		for _, inputCh := range inputChs {
-			wg.Add(1)
-
-			go func(inputCh chan errorItem) {
-				defer wg.Done()
-				for item := range inputCh {
-					outCh <- item
-				}
-			}(inputCh)
-		}
-
-		wg.Wait()
-		close(outCh)
-	}()
-
-	return outCh
+	return middleware.ClientIP(r, nil)
 }
 
-func Hash(s string) uint32 {
-	h := fnv.New32a()
-	h.Write([]byte(s))
-	return h.Sum32()
+// hashIP returns salted hash of IP address to not store it as is.
+func hashIP(ip, salt string) string {
+	sum := sha256.Sum256([]byte(salt + ip))
+	return hex.EncodeToString(sum[:16])
 }
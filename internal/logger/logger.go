@@ -0,0 +1,117 @@
+// Package logger provides structured leveled logger of the service and
+// helpers redacting sensitive values before they are logged.
+package logger
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Formats of log entries.
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// redacted replaces sensitive values in log entries.
+const redacted = "REDACTED"
+
+var (
+	level = zap.NewAtomicLevelAt(zap.InfoLevel)
+	// Log is logger of the service. It writes JSON entries at info level
+	// until Initialize is called.
+	Log = newLogger(FormatJSON)
+)
+
+type ctxKey struct{}
+
+// Initialize sets level and format of Log. Level can be changed at runtime
+// by LevelHandler. Entries written by standard log package are redirected to
+// Log at info level.
+func Initialize(lvl, format string) error {
+	if lvl != "" {
+		if err := level.UnmarshalText([]byte(lvl)); err != nil {
+			return err
+		}
+	}
+	if format != "" && format != FormatJSON && format != FormatText {
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	Log = newLogger(format)
+	zap.RedirectStdLog(Log)
+	return nil
+}
+
+func newLogger(format string) *zap.Logger {
+	cfg := zap.NewProductionEncoderConfig()
+	cfg.EncodeTime = zapcore.ISO8601TimeEncoder
+	cfg.EncodeDuration = zapcore.StringDurationEncoder
+
+	var enc zapcore.Encoder
+	if format == FormatText {
+		cfg.EncodeLevel = zapcore.CapitalLevelEncoder
+		enc = zapcore.NewConsoleEncoder(cfg)
+	} else {
+		enc = zapcore.NewJSONEncoder(cfg)
+	}
+	core := zapcore.NewCore(enc, zapcore.Lock(os.Stderr), level)
+	return zap.New(core, zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr)))
+}
+
+// LevelHandler reports level of Log as {"level":"info"} on GET and changes
+// it on PUT with the same body.
+func LevelHandler() http.Handler {
+	return level
+}
+
+// WithLogger returns copy of ctx carrying l.
+func WithLogger(ctx context.Context, l *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, l)
+}
+
+// FromContext returns logger stored in ctx by WithLogger or Log.
+func FromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(ctxKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return Log
+}
+
+// RedactURL removes user info, query string and fragment from rawURL as they
+// often contain tokens and personal data.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = redacted
+	}
+	u.ForceQuery = false
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
+}
+
+// URL returns field of URL redacted by RedactURL.
+func URL(key, rawURL string) zap.Field {
+	return zap.String(key, RedactURL(rawURL))
+}
+
+// UserID returns field with hash of user ID, so entries of one user can be
+// correlated without logging the ID itself.
+func UserID(userID string) zap.Field {
+	sum := sha256.Sum256([]byte(userID))
+	return zap.String("user", hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Formats of access log.
+const (
+	AccessLogJSON   = "json"
+	AccessLogCommon = "common"
+	AccessLogOff    = "off"
+)
+
+// clfTimeFormat is time format of Common Log Format.
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessEntry is access log entry of one request.
+type accessEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Remote    string    `json:"remote"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Path      string    `json:"path"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int       `json:"bytes"`
+	Duration  float64   `json:"duration_ms"`
+	Gzip      bool      `json:"gzip"`
+}
+
+// AccessLog returns middleware writing one line per request to out in
+// format: json (default), common or off. Common format is Common Log Format
+// line followed by route, duration, gzip and request ID. Query string is not
+// logged as it often contains tokens and personal data. Middleware must be
+// used by chi router after RequestID.
+func AccessLog(format string, out io.Writer) (func(http.Handler) http.Handler, error) {
+	var write func(io.Writer, *accessEntry) error
+	switch format {
+	case AccessLogJSON, "":
+		write = writeAccessJSON
+	case AccessLogCommon:
+		write = writeAccessCommon
+	case AccessLogOff:
+		return func(next http.Handler) http.Handler { return next }, nil
+	default:
+		return nil, fmt.Errorf("unknown access log format %q", format)
+	}
+
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			e := &accessEntry{
+				Time:      start,
+				RequestID: RequestIDFromContext(r.Context()),
+				Remote:    r.RemoteAddr,
+				Method:    r.Method,
+				Route:     unmatchedRoute,
+				Path:      r.URL.Path,
+				Proto:     r.Proto,
+				Status:    sw.Status(),
+				Bytes:     sw.bytes,
+				Duration:  float64(time.Since(start).Microseconds()) / 1000,
+				Gzip:      strings.Contains(w.Header().Get("Content-Encoding"), "gzip"),
+			}
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				e.Remote = host
+			}
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				e.Route = rctx.RoutePattern()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			_ = write(out, e)
+		})
+	}, nil
+}
+
+func writeAccessJSON(out io.Writer, e *accessEntry) error {
+	return json.NewEncoder(out).Encode(e)
+}
+
+func writeAccessCommon(out io.Writer, e *accessEntry) error {
+	_, err := fmt.Fprintf(out, "%s - - [%s] %q %d %d route=%q duration=%.3fms gzip=%t request_id=%s\n",
+		e.Remote, e.Time.Format(clfTimeFormat), e.Method+" "+e.Path+" "+e.Proto,
+		e.Status, e.Bytes, e.Route, e.Duration, e.Gzip, e.RequestID)
+	return err
+}
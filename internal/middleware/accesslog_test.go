@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newAccessLogRouter(t *testing.T, format string, out *bytes.Buffer) *chi.Mux {
+	accessLog, err := AccessLog(format, out)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(RequestID, accessLog, GzipCompressHandler)
+	r.Get("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("hello"))
+	})
+	return r
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	var out bytes.Buffer
+	r := newAccessLogRouter(t, AccessLogJSON, &out)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc?token=secret", nil)
+	req.Header.Set(RequestIDHeader, "test")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var e map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &e))
+	assert.Equal(t, "test", e["request_id"])
+	assert.Equal(t, "192.0.2.1", e["remote"])
+	assert.Equal(t, http.MethodGet, e["method"])
+	assert.Equal(t, "/{ID}", e["route"])
+	assert.Equal(t, "/abc", e["path"])
+	assert.Equal(t, float64(http.StatusTeapot), e["status"])
+	assert.Equal(t, float64(len("hello")), e["bytes"])
+	assert.Equal(t, false, e["gzip"])
+	assert.NotContains(t, out.String(), "secret")
+}
+
+func TestAccessLogCommon(t *testing.T) {
+	var out bytes.Buffer
+	r := newAccessLogRouter(t, AccessLogCommon, &out)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set(RequestIDHeader, "test")
+	req.Header.Set("Accept-Encoding", "gzip")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := regexp.MustCompile(`^192\.0\.2\.1 - - \[[^\]]+\] "GET /abc HTTP/1\.1" 418 \d+ route="/\{ID\}" duration=[0-9.]+ms gzip=true request_id=test\n$`)
+	assert.Regexp(t, line, out.String())
+}
+
+func TestAccessLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	r := newAccessLogRouter(t, AccessLogOff, &out)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+	assert.Empty(t, out.String())
+
+	_, err := AccessLog("xml", &out)
+	assert.Error(t, err)
+}
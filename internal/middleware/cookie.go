@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+)
+
+// UserIDCookie is name of cookie with signed user ID.
+const UserIDCookie = "user_id"
+
+// ErrNoUserID returned when request context has no authenticated user ID.
+var ErrNoUserID = errors.New("user id not found")
+
+type ctxKey int
+
+const (
+	userIDKey ctxKey = iota
+	requestIDKey
+	clientIPKey
+)
+
+// WithUserID returns copy of ctx with authenticated user ID. Logger of ctx
+// writes hash of user ID in every entry.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	ctx = context.WithValue(ctx, userIDKey, userID)
+	return logger.WithLogger(ctx, logger.FromContext(ctx).With(logger.UserID(userID)))
+}
+
+// UserIDFromContext returns user ID authenticated by CookieMiddleware.
+func UserIDFromContext(ctx context.Context) (string, error) {
+	userID, ok := ctx.Value(userIDKey).(string)
+	if !ok || userID == "" {
+		return "", ErrNoUserID
+	}
+	return userID, nil
+}
+
+// CookieSigner signs user ID with HMAC-SHA256. Values signed with one of
+// previous keys are still valid to allow keys rotation.
+type CookieSigner struct {
+	key      []byte
+	previous [][]byte
+}
+
+// NewCookieSigner create CookieSigner.
+func NewCookieSigner(key string, previous []string) *CookieSigner {
+	s := &CookieSigner{key: []byte(key)}
+	for _, k := range previous {
+		if k != "" {
+			s.previous = append(s.previous, []byte(k))
+		}
+	}
+	return s
+}
+
+// Sign returns cookie value in format <userID>.<signature>.
+func (s *CookieSigner) Sign(userID string) string {
+	return userID + "." + sign(s.key, userID)
+}
+
+// Verify returns user ID from signed cookie value. Rotated is true when value
+// is signed with one of previous keys and has to be signed again.
+func (s *CookieSigner) Verify(value string) (userID string, rotated bool, err error) {
+	i := strings.LastIndex(value, ".")
+	if i <= 0 {
+		return "", false, errors.New("cookie is not signed")
+	}
+	userID, signature := value[:i], value[i+1:]
+
+	if hmac.Equal([]byte(signature), []byte(sign(s.key, userID))) {
+		return userID, false, nil
+	}
+	for _, key := range s.previous {
+		if hmac.Equal([]byte(signature), []byte(sign(key, userID))) {
+			return userID, true, nil
+		}
+	}
+	return "", false, errors.New("invalid cookie signature")
+}
+
+func sign(key []byte, userID string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(userID))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// CookieMiddleware define user_id in signed cookie and put user ID in request context.
+// Cookie is issued again when it is absent, fails verification or signed with
+// previous key.
+func CookieMiddleware(signer *CookieSigner, secure bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var userID string
+			rotated := false
+
+			cookie, err := r.Cookie(UserIDCookie)
+			if err == nil {
+				userID, rotated, err = signer.Verify(cookie.Value)
+				if err != nil {
+					logger.FromContext(r.Context()).Info("failed to verify cookie",
+						zap.String("cookie", UserIDCookie), zap.Error(err))
+				}
+			}
+
+			if userID == "" {
+				userID, err = GenerateToken(10)
+				if err != nil {
+					logger.FromContext(r.Context()).Error("failed to generate user id",
+						zap.String("cookie", UserIDCookie), zap.Error(err))
+					next.ServeHTTP(w, r)
+					return
+				}
+				rotated = true
+			}
+
+			if rotated {
+				http.SetCookie(w, &http.Cookie{
+					Name:     UserIDCookie,
+					Value:    signer.Sign(userID),
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   secure,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUserID(r.Context(), userID)))
+		})
+	}
+}
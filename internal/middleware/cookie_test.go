@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieMiddleware(t *testing.T) {
+	signer := NewCookieSigner("new-key", []string{"old-key"})
+	oldSigner := NewCookieSigner("old-key", nil)
+	forgedSigner := NewCookieSigner("forged-key", nil)
+
+	tests := []struct {
+		name       string
+		cookie     string
+		wantUserID string
+		wantCookie bool
+	}{
+		{name: "no cookie", wantCookie: true},
+		{name: "valid cookie", cookie: signer.Sign("user"), wantUserID: "user"},
+		{name: "cookie signed with previous key", cookie: oldSigner.Sign("user"), wantUserID: "user", wantCookie: true},
+		{name: "forged cookie", cookie: forgedSigner.Sign("user"), wantCookie: true},
+		{name: "unsigned cookie", cookie: "user", wantCookie: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userID string
+			h := CookieMiddleware(signer, true)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var err error
+				userID, err = UserIDFromContext(r.Context())
+				require.NoError(t, err)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: UserIDCookie, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if tt.wantUserID != "" {
+				assert.Equal(t, tt.wantUserID, userID)
+			} else {
+				assert.NotEqual(t, "user", userID)
+			}
+
+			cookies := w.Result().Cookies()
+			if !tt.wantCookie {
+				assert.Empty(t, cookies)
+				return
+			}
+			require.Len(t, cookies, 1)
+			assert.Equal(t, signer.Sign(userID), cookies[0].Value)
+			assert.True(t, cookies[0].HttpOnly)
+			assert.True(t, cookies[0].Secure)
+			assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+)
+
+// RequestIDHeader is header with ID of request. ID from request header is
+// used when it is valid, the header is always set in response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength limits length of request ID accepted from client.
+const maxRequestIDLength = 128
+
+// WithRequestID returns copy of ctx with request ID and logger writing it in
+// every entry.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey, requestID)
+	return logger.WithLogger(ctx, logger.FromContext(ctx).With(zap.String("request_id", requestID)))
+}
+
+// RequestIDFromContext returns ID of request, empty when it is not set.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey).(string)
+	return requestID
+}
+
+// NewRequestID generates random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID reports whether request ID received from client can be
+// used: it is not empty, not too long and contains only letters, digits and
+// "-", "_", ".", ":" characters, so it is safe to write in logs and headers.
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestID takes request ID from X-Request-ID header or generates new one,
+// echoes it in response header and puts it with logger of request in request
+// context.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !ValidRequestID(requestID) {
+			requestID = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// Error replies to request with plain text error like http.Error, ID of
+// request is added to message to find log entries of failed request.
+func Error(w http.ResponseWriter, r *http.Request, msg string, code int) {
+	if requestID := RequestIDFromContext(r.Context()); requestID != "" {
+		msg += "\nrequest id: " + requestID
+	}
+	http.Error(w, msg, code)
+}
+
+// Logger returns logger of request with its route pattern. Pattern is known
+// when request is routed, so it must be called by handlers.
+func Logger(r *http.Request) *zap.Logger {
+	l := logger.FromContext(r.Context())
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		l = l.With(zap.String("route", rctx.RoutePattern()))
+	}
+	return l
+}
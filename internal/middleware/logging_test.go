@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/paramonies/internal/logger"
+)
+
+func TestRequestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defer func(l *zap.Logger) { logger.Log = l }(logger.Log)
+	logger.Log = zap.New(core)
+
+	r := chi.NewRouter()
+	r.Use(RequestID)
+	r.Use(CookieMiddleware(NewCookieSigner("secret", nil), false))
+	r.Get("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, RequestIDFromContext(r.Context()))
+		Logger(r).Info("test")
+	})
+
+	for i := 0; i < 2; i++ {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/abc", nil))
+	}
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+	first, second := entries[0].ContextMap(), entries[1].ContextMap()
+	assert.Equal(t, "/{ID}", first["route"])
+	assert.NotEmpty(t, first["user"])
+	assert.NotEmpty(t, first["request_id"])
+	assert.NotEqual(t, first["request_id"], second["request_id"])
+}
+
+func TestRequestID(t *testing.T) {
+	h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Error(w, r, "failed", http.StatusBadRequest)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "valid", header: "abc-123_x.y:z", keep: true},
+		{name: "empty", header: ""},
+		{name: "invalid characters", header: "abc\"def"},
+		{name: "too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(RequestIDHeader, tt.header)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, requestID)
+			if tt.keep {
+				assert.Equal(t, tt.header, requestID)
+			} else {
+				assert.NotEqual(t, tt.header, requestID)
+			}
+			assert.Equal(t, "failed\nrequest id: "+requestID+"\n", w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m, err := NewHTTPMetrics(reg)
+	require.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(m.Handler)
+	r.Get("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "ID") == "gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+
+	for _, path := range []string{"/a", "/b", "/gone", "/a/b"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/{ID}", "200")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, "/{ID}", "410")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.requests.WithLabelValues(http.MethodGet, unmatchedRoute, "404")))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.duration, "shortener_http_request_duration_seconds"))
+}
@@ -3,9 +3,7 @@ package middleware
 
 import (
 	"compress/gzip"
-	"errors"
 	"io"
-	"log"
 	"net/http"
 	"strings"
 )
@@ -20,6 +18,21 @@ func (gz GzipWriter) Write(p []byte) (int, error) {
 	return gz.Writer.Write(p)
 }
 
+// Flush sends compressed data written so far to client, it is used by streaming handlers.
+func (gz GzipWriter) Flush() {
+	if f, ok := gz.Writer.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := gz.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns original ResponseWriter for http.ResponseController.
+func (gz GzipWriter) Unwrap() http.ResponseWriter {
+	return gz.ResponseWriter
+}
+
 func NewGzipWriter(rw http.ResponseWriter, w io.Writer) GzipWriter {
 	return GzipWriter{ResponseWriter: rw, Writer: w}
 }
@@ -31,6 +44,9 @@ func GzipCompressHandler(next http.Handler) http.Handler {
 			return
 		}
 
+		ctx, span := tracer.Start(r.Context(), "gzip compress")
+		defer span.End()
+
 		gzipw, err := gzip.NewWriterLevel(w, gzip.BestSpeed)
 		if err != nil {
 			io.WriteString(w, err.Error())
@@ -40,57 +56,43 @@ func GzipCompressHandler(next http.Handler) http.Handler {
 		defer gzipw.Close()
 
 		w.Header().Set("Content-Encoding", "gzip")
-		next.ServeHTTP(NewGzipWriter(w, gzipw), r)
+		next.ServeHTTP(NewGzipWriter(w, gzipw), r.WithContext(ctx))
 	})
 }
 
+// GzipDECompressHandler replaces gzip compressed request body with
+// decompressing reader, body is not buffered.
 func GzipDECompressHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var reader io.Reader
-		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-			gzipr, err := gzip.NewReader(r.Body)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-			reader = gzipr
-			defer gzipr.Close()
-		} else {
-			reader = r.Body
+		if !strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+			next.ServeHTTP(w, r)
+			return
 		}
 
-		b, err := io.ReadAll(reader)
+		ctx, span := tracer.Start(r.Context(), "gzip decompress")
+		defer span.End()
+
+		gzipr, err := gzip.NewReader(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			Error(w, r, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		defer gzipr.Close()
 
-		r.Body = io.NopCloser(strings.NewReader(string(b)))
-		r.ContentLength = int64(len(b))
-		next.ServeHTTP(w, r)
+		r.Body = gzipBody{Reader: gzipr, body: r.Body}
+		r.ContentLength = -1
+		r.Header.Del("Content-Encoding")
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-// CookieMiddleware define user_id in cookie.
-func CookieMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_, err := r.Cookie("user_id")
-
-		if errors.Is(err, http.ErrNoCookie) {
-			userID, err := GenerateToken(10)
-			if err != nil {
-				log.Println("failed to generate token for \"user_id\" cookie: ", err)
-			} else {
-				cookie := &http.Cookie{
-					Name:   "user_id",
-					Value:  userID,
-					Secure: false,
-				}
-				r.AddCookie(cookie)
-				http.SetCookie(w, cookie)
-			}
-		}
+// gzipBody reads decompressed data and closes original body.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
 
-		next.ServeHTTP(w, r)
-	})
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
 }
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientIP returns address of client made the request. X-Real-IP and
+// X-Forwarded-For headers are taken into account only when the request came
+// from one of trusted proxies, any other client could forge them.
+func ClientIP(r *http.Request, proxies TrustedSubnets) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !proxies.Contains(host) {
+		return host
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	// every proxy appends address of its client, the rightmost address not
+	// belonging to trusted proxies is the client
+	ips := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(ips) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(ips[i])
+		if ip == "" {
+			continue
+		}
+		host = ip
+		if !proxies.Contains(ip) {
+			break
+		}
+	}
+	return host
+}
+
+// RealIP puts address of client returned by ClientIP into request context.
+func RealIP(proxies TrustedSubnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), clientIPKey, ClientIP(r, proxies))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClientIPFromContext returns address of client resolved by RealIP.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedSubnets("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		realIP       string
+		forwardedFor string
+		want         string
+	}{
+		{name: "direct", remoteAddr: "1.2.3.4:5678", want: "1.2.3.4"},
+		{name: "forged X-Real-IP", remoteAddr: "1.2.3.4:5678", realIP: "5.6.7.8", want: "1.2.3.4"},
+		{name: "forged X-Forwarded-For", remoteAddr: "1.2.3.4:5678", forwardedFor: "5.6.7.8", want: "1.2.3.4"},
+		{name: "X-Real-IP of proxy", remoteAddr: "10.0.0.1:5678", realIP: "5.6.7.8", want: "5.6.7.8"},
+		{name: "X-Forwarded-For of proxy", remoteAddr: "10.0.0.1:5678", forwardedFor: "5.6.7.8", want: "5.6.7.8"},
+		{name: "X-Forwarded-For forged before proxy", remoteAddr: "10.0.0.1:5678", forwardedFor: "9.9.9.9, 5.6.7.8", want: "5.6.7.8"},
+		{name: "X-Forwarded-For of proxies chain", remoteAddr: "10.0.0.1:5678", forwardedFor: "5.6.7.8, 10.0.0.2", want: "5.6.7.8"},
+		{name: "proxy without headers", remoteAddr: "10.0.0.1:5678", want: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			assert.Equal(t, tt.want, ClientIP(req, proxies))
+		})
+	}
+}
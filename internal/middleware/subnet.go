@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TrustedSubnets is a set of CIDR subnets allowed to call internal API.
+type TrustedSubnets []*net.IPNet
+
+// ParseTrustedSubnets parses comma separated list of CIDR subnets.
+func ParseTrustedSubnets(s string) (TrustedSubnets, error) {
+	var subnets TrustedSubnets
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet: %w", err)
+		}
+		subnets = append(subnets, subnet)
+	}
+	return subnets, nil
+}
+
+// Contains reports whether ip belongs to one of subnets.
+// Empty set does not contain any address.
+func (t TrustedSubnets) Contains(ip string) bool {
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if addr == nil {
+		return false
+	}
+	for _, subnet := range t {
+		if subnet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedSubnetMiddleware responds 403 Forbidden when address of client
+// resolved by RealIP does not belong to trusted subnets. Address of connection
+// is checked when RealIP is not used.
+func TrustedSubnetMiddleware(subnets TrustedSubnets) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := ClientIPFromContext(r.Context())
+			if ip == "" {
+				ip = ClientIP(r, nil)
+			}
+			if !subnets.Contains(ip) {
+				Logger(r).Warn("access is forbidden for untrusted ip", zap.String("ip", ip))
+				Error(w, r, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
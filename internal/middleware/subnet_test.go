@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	subnets, err := ParseTrustedSubnets("192.168.1.0/24, 10.0.0.0/8")
+	require.NoError(t, err)
+	proxies, err := ParseTrustedSubnets("192.0.2.0/24")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		wantStatus int
+	}{
+		{name: "no header", wantStatus: http.StatusForbidden},
+		{name: "first subnet", realIP: "192.168.1.15", wantStatus: http.StatusOK},
+		{name: "second subnet", realIP: "10.20.30.40", wantStatus: http.StatusOK},
+		{name: "untrusted ip", realIP: "192.168.2.1", wantStatus: http.StatusForbidden},
+		{name: "invalid ip", realIP: "localhost", wantStatus: http.StatusForbidden},
+		{name: "spoofed header of untrusted peer", remoteAddr: "203.0.113.5:1234", realIP: "192.168.1.15", wantStatus: http.StatusForbidden},
+		{name: "direct client from subnet", remoteAddr: "10.1.2.3:1234", wantStatus: http.StatusOK},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RealIP(proxies)(TrustedSubnetMiddleware(subnets)(next))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestParseTrustedSubnets(t *testing.T) {
+	subnets, err := ParseTrustedSubnets("")
+	require.NoError(t, err)
+	assert.False(t, subnets.Contains("127.0.0.1"))
+
+	_, err = ParseTrustedSubnets("192.168.1.0")
+	assert.Error(t, err)
+}
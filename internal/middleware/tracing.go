@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+)
+
+var tracer = otel.Tracer("github.com/paramonies/internal/middleware")
+
+// Tracing starts server span of request continuing trace from W3C
+// traceparent header. Span is named by route pattern, path is recorded
+// without query string. Trace ID is added to logger of request. Middleware
+// must be used by chi router after RequestID.
+func Tracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPServerMetricAttributesFromHTTPRequest("", r)...),
+			trace.WithAttributes(semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+				attribute.String("http.request_id", RequestIDFromContext(ctx))),
+		)
+		defer span.End()
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			ctx = logger.WithLogger(ctx, logger.FromContext(ctx).With(zap.String("trace_id", sc.TraceID().String())))
+		}
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			span.SetName(r.Method + " " + rctx.RoutePattern())
+			span.SetAttributes(semconv.HTTPRouteKey.String(rctx.RoutePattern()))
+		}
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sw.Status())...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(sw.Status(), trace.SpanKindServer))
+	})
+}
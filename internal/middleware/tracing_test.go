@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	r := chi.NewRouter()
+	r.Use(RequestID, Tracing, GzipCompressHandler)
+	r.Get("/{ID}", func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, trace.SpanContextFromContext(r.Context()).IsValid())
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/abc?token=secret", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929b0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set(RequestIDHeader, "test")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	require.Len(t, spans, 2)
+	gzipSpan, server := spans[0], spans[1]
+
+	assert.Equal(t, "gzip compress", gzipSpan.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), gzipSpan.Parent().SpanID())
+
+	assert.Equal(t, "GET /{ID}", server.Name())
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929b0e0e4736", server.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.True(t, server.Parent().IsRemote())
+	assert.Contains(t, server.Attributes(), attribute.String("http.method", http.MethodGet))
+	assert.Contains(t, server.Attributes(), attribute.String("http.route", "/{ID}"))
+	assert.Contains(t, server.Attributes(), attribute.String("http.target", "/abc"))
+	assert.Contains(t, server.Attributes(), attribute.String("http.request_id", "test"))
+	assert.Contains(t, server.Attributes(), attribute.Int("http.status_code", http.StatusInternalServerError))
+	assert.Equal(t, codes.Error, server.Status().Code)
+}
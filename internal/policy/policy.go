@@ -0,0 +1,232 @@
+// Package policy decides which destination URLs can be shortened.
+package policy
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/urlnorm"
+)
+
+// DefaultReloadInterval used when reload interval of domains file is not configured.
+const DefaultReloadInterval = 10 * time.Second
+
+// Rules of policy reported by Violation.
+const (
+	RuleScheme           = "scheme"
+	RuleOwnHost          = "own_host"
+	RuleDomainBlocked    = "domain_blocked"
+	RuleDomainNotAllowed = "domain_not_allowed"
+)
+
+// DefaultSchemes are allowed when schemes are not configured.
+var DefaultSchemes = []string{"http", "https"}
+
+// ErrViolation is wrapped by every Violation.
+var ErrViolation = errors.New("url violates policy")
+
+// Violation describes rule broken by URL.
+type Violation struct {
+	Rule   string
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("%v: %s", ErrViolation, v.Reason)
+}
+
+func (v *Violation) Unwrap() error {
+	return ErrViolation
+}
+
+// Policy checks scheme and host of destination URLs. Domain rules are loaded
+// from file with lines "allow <domain>" or "deny <domain>", rules match
+// subdomains too. When file has allow rules only allowed domains can be
+// shortened. Empty lines and lines starting with "#" are skipped.
+type Policy struct {
+	schemes  map[string]bool
+	ownHost  string
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	modTime time.Time
+	allowed []string
+	denied  []string
+}
+
+// New create Policy allowing schemes, DefaultSchemes when empty, and
+// forbidding links to host of baseURL. Domain rules are read from path when it
+// is not empty and reloaded every interval by Watch.
+func New(schemes []string, baseURL, path string, interval time.Duration) (*Policy, error) {
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	p := &Policy{schemes: make(map[string]bool), path: path, interval: interval}
+	for _, s := range schemes {
+		p.schemes[strings.ToLower(strings.TrimSpace(s))] = true
+	}
+
+	if baseURL != "" {
+		canonical, err := urlnorm.Canonicalize(baseURL, urlnorm.Options{})
+		if err != nil {
+			return nil, fmt.Errorf("invalid base url: %w", err)
+		}
+		u, err := url.Parse(canonical)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base url: %w", err)
+		}
+		p.ownHost = hostname(u)
+	}
+
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Check returns *Violation when canonical URL breaks policy.
+func (p *Policy) Check(canonical string) error {
+	u, err := url.Parse(canonical)
+	if err != nil {
+		return err
+	}
+	if !p.schemes[u.Scheme] {
+		return &Violation{Rule: RuleScheme, Reason: fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+	// port is ignored, any port of own host may lead to the shortener
+	host := hostname(u)
+	if host == "" || host == p.ownHost {
+		return &Violation{Rule: RuleOwnHost, Reason: "link to the shortener itself is not allowed"}
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if d, ok := match(host, p.denied); ok {
+		return &Violation{Rule: RuleDomainBlocked, Reason: fmt.Sprintf("domain %s is blocked", d)}
+	}
+	if _, ok := match(host, p.allowed); !ok && len(p.allowed) > 0 {
+		return &Violation{Rule: RuleDomainNotAllowed, Reason: fmt.Sprintf("domain %s is not allowed", host)}
+	}
+	return nil
+}
+
+// Reload reads domain rules again when file was modified since last load.
+func (p *Policy) Reload() error {
+	if p.path == "" {
+		return nil
+	}
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	p.mu.RLock()
+	modified := !info.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+	if !modified {
+		return nil
+	}
+
+	allowed, denied, err := readDomains(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.modTime = info.ModTime()
+	p.allowed, p.denied = allowed, denied
+	p.mu.Unlock()
+
+	logger.Log.Info("URL policy loaded", zap.String("path", p.path),
+		zap.Int("allowed", len(allowed)), zap.Int("denied", len(denied)))
+	return nil
+}
+
+// Watch reloads domain rules every interval until ctx is done. Rules are
+// kept when file can not be read.
+func (p *Policy) Watch(ctx context.Context) {
+	if p.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Reload(); err != nil {
+				logger.Log.Error("failed to reload URL policy", zap.Error(err))
+			}
+		}
+	}
+}
+
+func readDomains(path string) (allowed, denied []string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("%s:%d: rule must be \"allow <domain>\" or \"deny <domain>\"", path, n)
+		}
+		domain, err := urlnorm.ToASCII(strings.TrimSuffix(fields[1], "."))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+
+		switch fields[0] {
+		case "allow":
+			allowed = append(allowed, domain)
+		case "deny":
+			denied = append(denied, domain)
+		default:
+			return nil, nil, fmt.Errorf("%s:%d: unknown action %q", path, n, fields[0])
+		}
+	}
+	return allowed, denied, scanner.Err()
+}
+
+// hostname returns host of u without port and trailing dot of fully
+// qualified name, so equal hosts are compared equal.
+func hostname(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// match returns domain from domains which is host or its parent.
+func match(host string, domains []string) (string, bool) {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return d, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,96 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains")
+	require.NoError(t, os.WriteFile(path, []byte("# test rules\ndeny Evil.com\n\ndeny пример.рф\n"), 0644))
+
+	p, err := New(nil, "http://localhost:8080", path, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{url: "https://practicum.yandex.ru/a"},
+		{url: "http://localhost:9090/a", rule: RuleOwnHost},
+		{url: "javascript:alert(1)", rule: RuleScheme},
+		{url: "file:///etc/passwd", rule: RuleScheme},
+		{url: "data:text/html,test", rule: RuleScheme},
+		{url: "/relative", rule: RuleScheme},
+		{url: "http://localhost:8080/000000", rule: RuleOwnHost},
+		{url: "https://evil.com/a", rule: RuleDomainBlocked},
+		{url: "https://www.evil.com/a", rule: RuleDomainBlocked},
+		{url: "https://evil.com./a", rule: RuleDomainBlocked},
+		{url: "https://www.evil.com.:8443/a", rule: RuleDomainBlocked},
+		{url: "https://notevil.com/a"},
+		{url: "https://xn--e1afmkfd.xn--p1ai/", rule: RuleDomainBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := p.Check(tt.url)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var v *Violation
+			require.ErrorAs(t, err, &v)
+			assert.Equal(t, tt.rule, v.Rule)
+			assert.ErrorIs(t, err, ErrViolation)
+		})
+	}
+}
+
+func TestPolicyOwnHost(t *testing.T) {
+	p, err := New(nil, "https://short.ly", "", 0)
+	require.NoError(t, err)
+
+	for _, u := range []string{
+		"https://short.ly/abc",
+		"https://short.ly./abc",
+		"http://short.ly:443/abc",
+		"https://short.ly.:8443/abc",
+	} {
+		var v *Violation
+		require.ErrorAs(t, p.Check(u), &v, u)
+		assert.Equal(t, RuleOwnHost, v.Rule, u)
+	}
+	assert.NoError(t, p.Check("https://www.short.ly/abc"))
+}
+
+func TestPolicyReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "domains")
+	require.NoError(t, os.WriteFile(path, []byte("allow yandex.ru.\n"), 0644))
+
+	p, err := New([]string{"https"}, "", path, 0)
+	require.NoError(t, err)
+	assert.NoError(t, p.Check("https://practicum.yandex.ru/"))
+	assert.NoError(t, p.Check("https://yandex.ru./"))
+	var v *Violation
+	require.ErrorAs(t, p.Check("https://google.com/"), &v)
+	assert.Equal(t, RuleDomainNotAllowed, v.Rule)
+	require.ErrorAs(t, p.Check("http://yandex.ru/"), &v)
+	assert.Equal(t, RuleScheme, v.Rule)
+
+	require.NoError(t, os.WriteFile(path, []byte("deny yandex.ru\n"), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	require.NoError(t, p.Reload())
+	assert.NoError(t, p.Check("https://google.com/"))
+	require.ErrorAs(t, p.Check("https://practicum.yandex.ru/"), &v)
+	assert.Equal(t, RuleDomainBlocked, v.Rule)
+
+	// broken file keeps previous rules
+	require.NoError(t, os.WriteFile(path, []byte("block google.com\n"), 0644))
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second)))
+	assert.Error(t, p.Reload())
+	assert.NoError(t, p.Check("https://google.com/"))
+}
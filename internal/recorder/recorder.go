@@ -0,0 +1,103 @@
+// Package recorder records clicks on short URLs in background, so redirects do
+// not wait for repository.
+package recorder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/store"
+)
+
+// DefaultBufferSize used when buffer size is not configured.
+const DefaultBufferSize = 1000
+
+var (
+	// ErrClosed returned when clicks are added after Close.
+	ErrClosed = errors.New("recorder is closed")
+	// ErrBufferFull returned when click is dropped because buffer is full.
+	ErrBufferFull = errors.New("click buffer is full")
+)
+
+// Recorder buffers clicks and writes them to sink in background. Clicks are
+// dropped when buffer is full to not delay redirects.
+type Recorder struct {
+	dropped atomic.Int64
+
+	sink store.ClickSink
+
+	mu     sync.RWMutex
+	closed bool
+	input  chan store.Click
+	done   chan struct{}
+}
+
+// New create Recorder and start its worker. Close must be called to write buffered clicks.
+func New(sink store.ClickSink, size int) *Recorder {
+	if size <= 0 {
+		size = DefaultBufferSize
+	}
+
+	r := &Recorder{
+		sink:  sink,
+		input: make(chan store.Click, size),
+		done:  make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// AddClick queues click for writing without waiting for sink.
+func (r *Recorder) AddClick(_ context.Context, c store.Click) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		return ErrClosed
+	}
+	select {
+	case r.input <- c:
+		return nil
+	default:
+		r.dropped.Add(1)
+		return ErrBufferFull
+	}
+}
+
+// QueueLen returns number of clicks queued and not written yet.
+func (r *Recorder) QueueLen() int {
+	return len(r.input)
+}
+
+// Dropped returns number of clicks dropped because buffer was full.
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// Close stops accepting clicks and waits until buffered ones are written.
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.input)
+	}
+	r.mu.Unlock()
+
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	for c := range r.input {
+		if err := r.sink.AddClick(context.Background(), c); err != nil {
+			logger.Log.Warn("failed to record click", zap.String("id", c.URLID), zap.Error(err))
+		}
+	}
+	logger.Log.Info("stop recording clicks")
+}
@@ -0,0 +1,55 @@
+package recorder
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paramonies/internal/store"
+)
+
+// blockingSink waits for release before writing every click.
+type blockingSink struct {
+	*store.MapDB
+	release chan struct{}
+}
+
+func (s *blockingSink) AddClick(ctx context.Context, c store.Click) error {
+	<-s.release
+	return s.MapDB.AddClick(ctx, c)
+}
+
+func TestRecorderClose(t *testing.T) {
+	sink := store.NewMapDB()
+	r := New(sink, 0)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, r.AddClick(context.Background(), store.Click{URLID: "a", Time: time.Now()}))
+	}
+	r.Close()
+
+	stats, err := sink.GetStats(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stats.Clicks)
+	assert.ErrorIs(t, r.AddClick(context.Background(), store.Click{URLID: "a"}), ErrClosed)
+}
+
+func TestRecorderBufferFull(t *testing.T) {
+	sink := &blockingSink{MapDB: store.NewMapDB(), release: make(chan struct{})}
+	r := New(sink, 1)
+
+	// the first click is taken by worker, the second one fills buffer
+	require.NoError(t, r.AddClick(context.Background(), store.Click{URLID: "a"}))
+	require.Eventually(t, func() bool { return r.QueueLen() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, r.AddClick(context.Background(), store.Click{URLID: "a"}))
+	assert.ErrorIs(t, r.AddClick(context.Background(), store.Click{URLID: "a"}), ErrBufferFull)
+	assert.Equal(t, int64(1), r.Dropped())
+
+	close(sink.release)
+	r.Close()
+	stats, err := sink.GetStats(context.Background(), "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Clicks)
+}
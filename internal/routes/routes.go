@@ -2,31 +2,67 @@
 package routes
 
 import (
-	"log"
+	"expvar"
 	"net/http"
 	"net/http/pprof"
+	"os"
 
 	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
 
+	"github.com/paramonies/internal/config"
 	"github.com/paramonies/internal/handlers"
+	"github.com/paramonies/internal/logger"
 	"github.com/paramonies/internal/middleware"
 )
 
-func New(h *handlers.Handler) *chi.Mux {
-	log.Println("creating new chi-routes")
+// New create router of service. Metrics of requests are recorded when metrics is not nil.
+func New(h *handlers.Handler, cfg *config.Config, metrics *middleware.HTTPMetrics) *chi.Mux {
+	logger.Log.Debug("creating new chi-routes")
 	r := chi.NewRouter()
 
+	signer := middleware.NewCookieSigner(cfg.SecretKey, cfg.PreviousSecretKeys)
+	secure := cfg.EnableHTTPS != nil && *cfg.EnableHTTPS
+	subnets, err := middleware.ParseTrustedSubnets(cfg.TrustedSubnet)
+	if err != nil {
+		logger.Log.Warn("internal API is disabled", zap.Error(err))
+	}
+	proxies, err := middleware.ParseTrustedSubnets(cfg.TrustedProxies)
+	if err != nil {
+		logger.Log.Warn("client IP headers are not trusted", zap.Error(err))
+	}
+
+	r.Use(middleware.RequestID)
+	r.Use(middleware.RealIP(proxies))
+	r.Use(middleware.Tracing)
+	accessLog, err := middleware.AccessLog(cfg.AccessLogFormat, os.Stdout)
+	if err != nil {
+		logger.Log.Warn("access log is disabled", zap.Error(err))
+	} else {
+		r.Use(accessLog)
+	}
+	if metrics != nil {
+		r.Use(metrics.Handler)
+	}
 	r.Use(middleware.GzipDECompressHandler, middleware.GzipCompressHandler)
-	r.Use(middleware.CookieMiddleware)
+	r.Use(middleware.CookieMiddleware(signer, secure))
 
 	r.Post("/", h.CreateShortURL())
 	r.Post("/api/shorten", h.CreateShortURLFromJSON())
 	r.Post("/api/shorten/batch", h.CreateManyShortURL())
+	r.Post("/api/shorten/stream", h.CreateShortURLStream())
 	r.Get("/{ID}", h.GetURLByID())
 	r.Get("/api/user/urls", h.GetListByUserID())
+	r.Get("/api/user/urls/{ID}/stats", h.GetURLStats())
 	r.Delete("/api/user/urls", h.DeleteManyShortURL())
+	r.Get("/api/user/jobs/{jobID}", h.GetDeletionJob())
+	r.Post("/api/user/urls/restore", h.RestoreShortURLs())
 	r.Get("/ping", h.Ping())
+	r.Get("/healthz", h.Healthz())
+	r.Get("/readyz", h.Readyz())
+	r.With(middleware.TrustedSubnetMiddleware(subnets)).Get("/api/internal/stats", h.GetInternalStats())
 
+	r.Handle("/debug/vars", expvar.Handler())
 	r.Handle("/debug/pprof/", http.HandlerFunc(pprof.Index))
 	r.Handle("/debug/pprof/cmdline", http.HandlerFunc(pprof.Cmdline))
 	r.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
@@ -0,0 +1,36 @@
+package shortid
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Counter generates sequential identifiers encoded with alphabet.
+type Counter struct {
+	next     uint64
+	alphabet string
+	length   int
+}
+
+// NewCounter create Counter which first identifier encodes start.
+// ErrLengthTooShort is returned when start does not fit into length.
+func NewCounter(alphabet string, length int, start uint64) (*Counter, error) {
+	if err := validate(alphabet, length); err != nil {
+		return nil, err
+	}
+	if !fits(start, alphabet, length) {
+		return nil, fmt.Errorf("%w: %d symbols can not encode %d", ErrLengthTooShort, length, start)
+	}
+	return &Counter{next: start, alphabet: alphabet, length: length}, nil
+}
+
+func (c *Counter) sequential() {}
+
+// Generate returns ErrLengthTooShort when all identifiers of length are issued.
+func (c *Counter) Generate() (string, error) {
+	n := atomic.AddUint64(&c.next, 1) - 1
+	if !fits(n, c.alphabet, c.length) {
+		return "", ErrLengthTooShort
+	}
+	return encode(n, c.alphabet, c.length), nil
+}
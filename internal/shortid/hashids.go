@@ -0,0 +1,76 @@
+package shortid
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Hashids generates non-sequential looking identifiers from a counter
+// in the manner of hashids: the alphabet is shuffled with salt and
+// a lottery symbol reshuffles it again for every number.
+type Hashids struct {
+	next     uint64
+	alphabet string
+	salt     string
+	length   int
+}
+
+// NewHashids create Hashids generator which first identifier encodes start.
+// ErrLengthTooShort is returned when start does not fit into length.
+func NewHashids(alphabet, salt string, length int, start uint64) (*Hashids, error) {
+	if err := validate(alphabet, length); err != nil {
+		return nil, err
+	}
+	if !fits(start, alphabet, digits(length)) {
+		return nil, fmt.Errorf("%w: %d symbols can not encode %d", ErrLengthTooShort, length, start)
+	}
+	return &Hashids{
+		next:     start,
+		alphabet: shuffle(alphabet, salt),
+		salt:     salt,
+		length:   length,
+	}, nil
+}
+
+func (g *Hashids) sequential() {}
+
+// Generate returns ErrLengthTooShort when all identifiers of length are issued.
+func (g *Hashids) Generate() (string, error) {
+	n := atomic.AddUint64(&g.next, 1) - 1
+	length := digits(g.length)
+	if !fits(n, g.alphabet, length) {
+		return "", ErrLengthTooShort
+	}
+
+	lottery := g.alphabet[n%uint64(len(g.alphabet))]
+	alphabet := shuffle(g.alphabet, string(lottery)+g.salt)
+
+	return string(lottery) + encode(n, alphabet, length), nil
+}
+
+// digits returns number of symbols encoding counter in identifier of length,
+// the first symbol is lottery.
+func digits(length int) int {
+	if length < 2 {
+		return 1
+	}
+	return length - 1
+}
+
+// shuffle implements hashids consistent shuffle of alphabet by salt.
+func shuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	res := []byte(alphabet)
+	for i, v, p := len(res)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		n := int(salt[v])
+		p += n
+		j := (n + v + p) % i
+		res[i], res[j] = res[j], res[i]
+		v++
+	}
+	return string(res)
+}
@@ -0,0 +1,42 @@
+package shortid
+
+import (
+	"crypto/rand"
+)
+
+// Random generates identifiers of fixed length from crypto-random symbols.
+type Random struct {
+	alphabet string
+	length   int
+}
+
+// NewRandom create Random generator.
+func NewRandom(alphabet string, length int) (*Random, error) {
+	if err := validate(alphabet, length); err != nil {
+		return nil, err
+	}
+	return &Random{alphabet: alphabet, length: length}, nil
+}
+
+func (g *Random) Generate() (string, error) {
+	// bytes above limit are dropped to keep symbols uniformly distributed
+	limit := 256 - 256%len(g.alphabet)
+
+	id := make([]byte, 0, g.length)
+	b := make([]byte, g.length)
+	for len(id) < g.length {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, v := range b {
+			if int(v) >= limit {
+				continue
+			}
+			id = append(id, g.alphabet[int(v)%len(g.alphabet)])
+			if len(id) == g.length {
+				break
+			}
+		}
+	}
+	return string(id), nil
+}
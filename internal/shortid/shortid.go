@@ -0,0 +1,81 @@
+// Package shortid implements generators of short URL identifiers.
+package shortid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Base62Alphabet is the default alphabet for generated identifiers.
+const Base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+var (
+	// ErrInvalidAlphabet returned when alphabet is too short or contains repeated symbols.
+	ErrInvalidAlphabet = errors.New("alphabet must contain at least 2 unique ASCII symbols")
+	// ErrLengthTooShort returned when counter value does not fit into identifier length.
+	ErrLengthTooShort = errors.New("id length is too short for counter value")
+)
+
+// IDGenerator generates identifiers for short URLs.
+// Each call may return a new identifier, collisions are checked by the caller.
+type IDGenerator interface {
+	Generate() (string, error)
+}
+
+// sequential is implemented by generators which never repeat identifiers.
+type sequential interface {
+	sequential()
+}
+
+// IsSequential reports whether gen never repeats identifiers. Collision of
+// such identifier is left by previous run or another instance, so the next
+// identifier may be free.
+func IsSequential(gen IDGenerator) bool {
+	_, ok := gen.(sequential)
+	return ok
+}
+
+func validate(alphabet string, length int) error {
+	if length <= 0 {
+		return fmt.Errorf("invalid id length %d", length)
+	}
+	if len(alphabet) < 2 {
+		return ErrInvalidAlphabet
+	}
+
+	seen := make(map[rune]bool, len(alphabet))
+	for _, r := range alphabet {
+		if r > 127 || seen[r] {
+			return ErrInvalidAlphabet
+		}
+		seen[r] = true
+	}
+	return nil
+}
+
+// fits reports whether n is encoded with at most length symbols of alphabet.
+func fits(n uint64, alphabet string, length int) bool {
+	base := uint64(len(alphabet))
+	for i := 0; i < length && n > 0; i++ {
+		n /= base
+	}
+	return n == 0
+}
+
+// encode converts n into alphabet based positional notation padded to length.
+func encode(n uint64, alphabet string, length int) string {
+	base := uint64(len(alphabet))
+	buf := make([]byte, 0, length)
+	for n > 0 {
+		buf = append(buf, alphabet[n%base])
+		n /= base
+	}
+	for len(buf) < length {
+		buf = append(buf, alphabet[0])
+	}
+
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf)
+}
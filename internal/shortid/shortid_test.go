@@ -0,0 +1,94 @@
+package shortid
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerators(t *testing.T) {
+	counter, err := NewCounter(Base62Alphabet, 6, 0)
+	require.NoError(t, err)
+	random, err := NewRandom(Base62Alphabet, 8)
+	require.NoError(t, err)
+	hashids, err := NewHashids(Base62Alphabet, "salt", 8, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		gen    IDGenerator
+		length int
+	}{
+		{name: "counter", gen: counter, length: 6},
+		{name: "random", gen: random, length: 8},
+		{name: "hashids", gen: hashids, length: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for i := 0; i < 1000; i++ {
+				id, err := tt.gen.Generate()
+				require.NoError(t, err)
+				assert.Len(t, id, tt.length)
+				assert.Empty(t, strings.Trim(id, Base62Alphabet))
+				assert.False(t, seen[id], "duplicate id %s", id)
+				seen[id] = true
+			}
+		})
+	}
+}
+
+func TestCounterSequence(t *testing.T) {
+	gen, err := NewCounter("01", 4, 2)
+	require.NoError(t, err)
+
+	for _, want := range []string{"0010", "0011", "0100"} {
+		id, err := gen.Generate()
+		require.NoError(t, err)
+		assert.Equal(t, want, id)
+	}
+}
+
+func TestInvalidAlphabet(t *testing.T) {
+	_, err := NewRandom("aa", 8)
+	assert.ErrorIs(t, err, ErrInvalidAlphabet)
+
+	_, err = NewCounter("a", 8, 0)
+	assert.ErrorIs(t, err, ErrInvalidAlphabet)
+
+	_, err = NewHashids(Base62Alphabet, "", 0, 0)
+	assert.Error(t, err)
+}
+
+func TestLengthTooShort(t *testing.T) {
+	// counter based generators of service start from current time in milliseconds
+	start := uint64(1_800_000_000_000)
+
+	_, err := NewCounter(Base62Alphabet, 6, start)
+	assert.ErrorIs(t, err, ErrLengthTooShort)
+	_, err = NewHashids(Base62Alphabet, "salt", 7, start)
+	assert.ErrorIs(t, err, ErrLengthTooShort)
+
+	counter, err := NewCounter(Base62Alphabet, 7, start)
+	require.NoError(t, err)
+	id, err := counter.Generate()
+	require.NoError(t, err)
+	assert.Len(t, id, 7)
+	hashids, err := NewHashids(Base62Alphabet, "salt", 8, start)
+	require.NoError(t, err)
+	id, err = hashids.Generate()
+	require.NoError(t, err)
+	assert.Len(t, id, 8)
+
+	// identifiers never grow longer than length
+	gen, err := NewCounter("01", 2, 3)
+	require.NoError(t, err)
+	id, err = gen.Generate()
+	require.NoError(t, err)
+	assert.Equal(t, "11", id)
+	_, err = gen.Generate()
+	assert.ErrorIs(t, err, ErrLengthTooShort)
+}
@@ -0,0 +1,208 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheTTL is used by NewCachedRepository when ttl is not positive.
+const DefaultCacheTTL = time.Minute
+
+// CachedRepository is read-through LRU cache of Get results in front of any
+// Repository. Unknown and deleted short IDs are cached too. URL of expiring
+// link is cached until its expiration at most.
+type CachedRepository struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	Repository
+
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	lru     *list.List
+	entries map[string]*list.Element
+	// gen changes on every invalidation to not cache value read before it
+	gen uint64
+}
+
+// CacheStats contains counters of CachedRepository.
+type CacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+type cacheEntry struct {
+	key       string
+	url       string
+	err       error
+	expiresAt time.Time
+}
+
+// NewCachedRepository wraps rep with LRU cache of size entries living ttl.
+func NewCachedRepository(rep Repository, size int, ttl time.Duration) *CachedRepository {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &CachedRepository{
+		Repository: rep,
+		size:       size,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *CachedRepository) Get(ctx context.Context, key string) (string, error) {
+	entry, gen := c.lookup(key)
+	if entry != nil {
+		c.hits.Add(1)
+		return entry.url, entry.err
+	}
+	c.misses.Add(1)
+
+	rec, err := c.Repository.GetRecord(ctx, key)
+	if err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrGone) {
+		expiresAt := time.Now().Add(c.ttl)
+		if !rec.ExpiresAt.IsZero() && rec.ExpiresAt.Before(expiresAt) {
+			expiresAt = rec.ExpiresAt
+		}
+		c.store(gen, &cacheEntry{key: key, url: rec.URL, err: err, expiresAt: expiresAt})
+	}
+	return rec.URL, err
+}
+
+func (c *CachedRepository) Set(ctx context.Context, rec Record) error {
+	err := c.Repository.Set(ctx, rec)
+	// drop negative entry of the ID
+	c.invalidate(rec.ID)
+	return err
+}
+
+func (c *CachedRepository) SetBatch(ctx context.Context, recs []Record) ([]SetResult, error) {
+	results, err := c.Repository.SetBatch(ctx, recs)
+	for _, res := range results {
+		if res.Status == SetStatusCreated {
+			c.invalidate(res.ID)
+		}
+	}
+	return results, err
+}
+
+func (c *CachedRepository) Delete(ctx context.Context, urlID, userID string) error {
+	err := c.Repository.Delete(ctx, urlID, userID)
+	c.invalidate(urlID)
+	return err
+}
+
+func (c *CachedRepository) DeleteBatch(ctx context.Context, items []DeleteItem) ([]DeleteStatus, error) {
+	statuses, err := c.Repository.DeleteBatch(ctx, items)
+	for _, item := range items {
+		c.invalidate(item.URLID)
+	}
+	return statuses, err
+}
+
+func (c *CachedRepository) Restore(ctx context.Context, userID string, ids []string) ([]string, error) {
+	restored, err := c.Repository.Restore(ctx, userID, ids)
+	for _, id := range restored {
+		c.invalidate(id)
+	}
+	return restored, err
+}
+
+func (c *CachedRepository) PurgeDeleted(ctx context.Context, t time.Time) (int64, error) {
+	n, err := c.Repository.PurgeDeleted(ctx, t)
+	if n > 0 {
+		c.clear()
+	}
+	return n, err
+}
+
+func (c *CachedRepository) ArchiveExpired(ctx context.Context, now time.Time) (int64, error) {
+	n, err := c.Repository.ArchiveExpired(ctx, now)
+	if n > 0 {
+		c.clear()
+	}
+	return n, err
+}
+
+// CacheStats returns hit and miss counters and current number of cached entries.
+func (c *CachedRepository) CacheStats() CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return CacheStats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+// lookup returns live cached entry or nil together with current generation.
+func (c *CachedRepository) lookup(key string) (*cacheEntry, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, c.gen
+	}
+	entry := el.Value.(*cacheEntry)
+	if !time.Now().Before(entry.expiresAt) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil, c.gen
+	}
+	c.lru.MoveToFront(el)
+	return entry, c.gen
+}
+
+// store caches entry unless cache was invalidated after generation gen.
+func (c *CachedRepository) store(gen uint64, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+	key := entry.key
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+
+	for c.lru.Len() > c.size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.entries, last.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *CachedRepository) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+	}
+	c.gen++
+}
+
+func (c *CachedRepository) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.gen++
+}
@@ -0,0 +1,96 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedRepository(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	c := NewCachedRepository(db, 2, time.Minute)
+
+	require.NoError(t, c.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+
+	for i := 0; i < 3; i++ {
+		url, err := c.Get(ctx, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "https://a.ru", url)
+	}
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Size: 1}, c.CacheStats())
+
+	// unknown ID is cached until it is set
+	_, err := c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = c.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	require.NoError(t, c.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	url, err := c.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "https://b.ru", url)
+
+	// delete invalidates cached URL
+	require.NoError(t, c.Delete(ctx, "a", "user"))
+	_, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrGone)
+
+	// restore invalidates cached deletion
+	restored, err := c.Restore(ctx, "user", []string{"a"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, restored)
+	_, err = c.Get(ctx, "a")
+	assert.NoError(t, err)
+	require.NoError(t, c.Delete(ctx, "a", "user"))
+	_, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrGone)
+
+	// the least recently used entry is evicted
+	_, err = c.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+	stats := c.CacheStats()
+	assert.Equal(t, 2, stats.Size)
+	_, err = c.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, stats.Misses+1, c.CacheStats().Misses)
+}
+
+func TestCachedRepositoryTTL(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	c := NewCachedRepository(db, 10, 10*time.Millisecond)
+
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+
+	// change made bypassing cache is visible after ttl
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+	_, err = c.Get(ctx, "a")
+	assert.NoError(t, err)
+
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrGone)
+}
+
+func TestCachedRepositoryLinkExpiration(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	c := NewCachedRepository(db, 10, time.Minute)
+
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", ExpiresAt: time.Now().Add(20 * time.Millisecond)}))
+	_, err := c.Get(ctx, "a")
+	require.NoError(t, err)
+	_, err = c.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), c.CacheStats().Hits)
+
+	// cached URL does not outlive link
+	time.Sleep(30 * time.Millisecond)
+	_, err = c.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrGone)
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const dayLayout = "2006-01-02"
+
+// ClickSink stores redirects by short URLs and aggregates them into statistics.
+type ClickSink interface {
+	AddClick(ctx context.Context, c Click) error
+	GetStats(ctx context.Context, urlID string) (Stats, error)
+}
+
+// Click describes single redirect by short URL.
+type Click struct {
+	URLID     string    `json:"url_id"`
+	Time      time.Time `json:"time"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
+}
+
+// Stats contains total and per-day clicks by short URL.
+type Stats struct {
+	Clicks         int64      `json:"clicks"`
+	UniqueVisitors int64      `json:"unique_visitors"`
+	Daily          []DayStats `json:"daily"`
+}
+
+// DayStats contains clicks by short URL for one day in UTC.
+type DayStats struct {
+	Date           string `json:"date"`
+	Clicks         int64  `json:"clicks"`
+	UniqueVisitors int64  `json:"unique_visitors"`
+}
+
+// aggregateClicks computes Stats for in-memory stored clicks.
+func aggregateClicks(clicks []Click) Stats {
+	stats := Stats{Daily: []DayStats{}}
+	visitors := make(map[string]bool)
+	days := make(map[string]*DayStats)
+	dayVisitors := make(map[string]map[string]bool)
+
+	for _, c := range clicks {
+		stats.Clicks++
+		visitors[c.IPHash] = true
+
+		date := c.Time.UTC().Format(dayLayout)
+		day, ok := days[date]
+		if !ok {
+			day = &DayStats{Date: date}
+			days[date] = day
+			dayVisitors[date] = make(map[string]bool)
+		}
+		day.Clicks++
+		dayVisitors[date][c.IPHash] = true
+	}
+	stats.UniqueVisitors = int64(len(visitors))
+
+	for date, day := range days {
+		day.UniqueVisitors = int64(len(dayVisitors[date]))
+		stats.Daily = append(stats.Daily, *day)
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool {
+		return stats.Daily[i].Date < stats.Daily[j].Date
+	})
+
+	return stats
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+)
+
+// ErrCorruptedLog returned when FileDB log contains damaged entry which is not the last one.
+var ErrCorruptedLog = errors.New("corrupted file storage log")
+
+// Operations of FileDB log entries.
+const (
+	opSet     = "set"
+	opDelete  = "delete"
+	opRestore = "restore"
+)
+
+// checksumLength is number of hex digits of checksum of log entry.
+const checksumLength = 8
+
+// logEntry is one line of FileDB log. Line format is
+// "<crc32 of JSON in hex> <JSON>\n".
+type logEntry struct {
+	Op     string `json:"op"`
+	Record Record `json:"record"`
+	// DeletedAt is time of delete operation.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func deleteEntry(urlID, userID string, t time.Time) logEntry {
+	return logEntry{Op: opDelete, Record: Record{ID: urlID, UserID: userID}, DeletedAt: &t}
+}
+
+func encodeEntry(e logEntry) ([]byte, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return encodeLine(data), nil
+}
+
+func decodeEntry(line []byte) (logEntry, error) {
+	var e logEntry
+	data, err := decodeLine(line)
+	if err != nil {
+		return e, err
+	}
+	if err = json.Unmarshal(data, &e); err != nil {
+		return e, err
+	}
+	if e.Op != opSet && e.Op != opDelete && e.Op != opRestore {
+		return e, fmt.Errorf("unknown operation %q", e.Op)
+	}
+	return e, nil
+}
+
+// encodeLine frames data as "<crc32 of data in hex> <data>\n".
+func encodeLine(data []byte) []byte {
+	line := make([]byte, 0, len(data)+10)
+	line = append(line, fmt.Sprintf("%0*x ", checksumLength, crc32.ChecksumIEEE(data))...)
+	line = append(line, data...)
+	return append(line, '\n')
+}
+
+// decodeLine returns data of line framed by encodeLine after checksum is verified.
+func decodeLine(line []byte) ([]byte, error) {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	sep := bytes.IndexByte(line, ' ')
+	if sep < 0 {
+		return nil, errors.New("checksum not found")
+	}
+	sum, err := strconv.ParseUint(string(line[:sep]), 16, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum: %w", err)
+	}
+	data := line[sep+1:]
+	if crc32.ChecksumIEEE(data) != uint32(sum) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return data, nil
+}
+
+// readLog reads all entries of file. See readLines for handling of damaged lines.
+func readLog(file *os.File) ([]logEntry, error) {
+	var entries []logEntry
+	err := readLines(file, func(line []byte) error {
+		e, err := decodeEntry(line)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// readLines calls decode for every line of file. Damaged last line, which is
+// left by interrupted write, is cut off the file when it follows valid lines
+// or is beginning of a line. Other damaged lines result in ErrCorruptedLog,
+// so content of unknown format is never discarded.
+func readLines(file *os.File, decode func(line []byte) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	var valid int
+	var offset int64
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) == 0 && errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if errDecode := decode(line); errDecode != nil {
+			if _, errPeek := r.Peek(1); !errors.Is(errPeek, io.EOF) || (valid == 0 && !isPartialEntry(line)) {
+				return fmt.Errorf("%w: %s at offset %d: %v", ErrCorruptedLog, file.Name(), offset, errDecode)
+			}
+			logger.Log.Warn("truncate damaged last entry of file storage log",
+				zap.String("path", file.Name()), zap.Int64("offset", offset), zap.Error(errDecode))
+			return file.Truncate(offset)
+		}
+
+		valid++
+		offset += int64(len(line))
+	}
+}
+
+// isPartialEntry reports whether line without newline can be beginning of
+// log entry cut by interrupted write: it starts with checksum.
+func isPartialEntry(line []byte) bool {
+	if bytes.HasSuffix(line, []byte{'\n'}) {
+		return false
+	}
+	for i, c := range line {
+		switch {
+		case i == checksumLength:
+			return c == ' '
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'f':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// legacyRecord is value of file storage written before log format. Such file
+// contains concatenated records or object {"records": [...]}.
+type legacyRecord struct {
+	Record
+	Records []Record `json:"records"`
+}
+
+// convertLegacyFile rewrites file at path in legacy format as log of set
+// entries. File in log format or missing file is left as is.
+func convertLegacyFile(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	for {
+		c, err := r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if c == '{' {
+			break
+		}
+		if c != ' ' && c != '\n' && c != '\r' && c != '\t' {
+			return nil
+		}
+	}
+	if err = r.UnreadByte(); err != nil {
+		return err
+	}
+
+	var entries []logEntry
+	seen := make(map[string]bool)
+	add := func(rec Record) {
+		// the first record of ID was kept by legacy storage
+		if rec.ID == "" || seen[rec.ID] {
+			return
+		}
+		seen[rec.ID] = true
+		entries = append(entries, logEntry{Op: opSet, Record: rec})
+	}
+	dec := json.NewDecoder(r)
+	for {
+		var v legacyRecord
+		if err = dec.Decode(&v); errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s in legacy format: %v", ErrCorruptedLog, path, err)
+		}
+		for _, rec := range v.Records {
+			add(rec)
+		}
+		add(v.Record)
+	}
+
+	if err = writeSnapshot(path, entries); err != nil {
+		return err
+	}
+	logger.Log.Info("file storage converted from legacy format",
+		zap.String("path", path), zap.Int("records", len(entries)))
+	return nil
+}
+
+// writeSnapshot atomically replaces file at path with entries.
+func writeSnapshot(path string, entries []logEntry) error {
+	var data []byte
+	for _, e := range entries {
+		line, err := encodeEntry(e)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+	}
+	return replaceFile(path, data)
+}
+
+// replaceFile atomically replaces file at path with data.
+func replaceFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
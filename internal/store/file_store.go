@@ -1,105 +1,794 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
 )
 
-type Record struct {
-	ID     string `json:"id"`
-	URL    string `json:"url"`
-	UserID string `json:"user_id"`
-}
+// SyncPolicy defines when FileDB flushes log to disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways flushes log after every write.
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval flushes log every FileDBOptions.SyncInterval.
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to operating system.
+	SyncNever SyncPolicy = "never"
+)
+
+const (
+	// ClicksFileSuffix added to FileDB path to get path of file with clicks.
+	ClicksFileSuffix = ".clicks"
+	// SnapshotFileSuffix added to FileDB path to get path of compacted snapshot.
+	SnapshotFileSuffix = ".snapshot"
+
+	DefaultSyncInterval    = time.Second
+	DefaultCompactInterval = 10 * time.Minute
+)
 
-type RecordsCache struct {
-	Records []Record `json:"records"`
+// ErrInvalidSyncPolicy returned for unknown SyncPolicy.
+var ErrInvalidSyncPolicy = errors.New("invalid file sync policy")
+
+// FileDBOptions configures durability of FileDB. Zero value means
+// SyncAlways policy and default intervals.
+type FileDBOptions struct {
+	Sync            SyncPolicy
+	SyncInterval    time.Duration
+	CompactInterval time.Duration
+	// Canonicalize computes canonical form of URLs saved before
+	// canonicalization, such records are replayed without it.
+	Canonicalize func(rawURL string) (string, error)
 }
 
+// FileDB keeps records in memory indexed by short ID, original URL and user ID
+// and persists them into append-only log of set and delete entries. Log is
+// periodically compacted into snapshot file which is loaded before the log on start.
 type FileDB struct {
-	DB    *os.File
-	Cache RecordsCache
+	mu       sync.RWMutex
+	path     string
+	opts     FileDBOptions
+	log      *os.File
+	records  map[string]fileRecord
+	byURL    map[urlKey]string
+	byUser   map[string]map[string]struct{}
+	appended int
+	dirty    bool
+	// pending keeps IDs of replayed records without canonical form in order of saving.
+	pending []string
+
+	clicksDB    *os.File
+	clicksCache map[string][]Click
+	clicksDirty bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+type fileRecord struct {
+	Record
+	Deleted   bool
+	DeletedAt time.Time
+}
+
+// live reports whether record is neither deleted nor expired at now.
+func (r fileRecord) live(now time.Time) bool {
+	return !r.Deleted && !r.Expired(now)
 }
 
-func NewFileDB(path string) (*FileDB, error) {
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0755)
+func NewFileDB(path string, opts FileDBOptions) (*FileDB, error) {
+	switch opts.Sync {
+	case "":
+		opts.Sync = SyncAlways
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSyncPolicy, opts.Sync)
+	}
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = DefaultSyncInterval
+	}
+	if opts.CompactInterval <= 0 {
+		opts.CompactInterval = DefaultCompactInterval
+	}
+
+	f := &FileDB{
+		path:    path,
+		opts:    opts,
+		records: make(map[string]fileRecord),
+		byURL:   make(map[urlKey]string),
+		byUser:  make(map[string]map[string]struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if err := convertLegacyFile(path); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := os.OpenFile(path+SnapshotFileSuffix, os.O_RDONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readLog(snapshot)
+	snapshot.Close()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		f.apply(e)
+	}
+
+	f.log, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	entries, err = readLog(f.log)
 	if err != nil {
+		f.log.Close()
 		return nil, err
 	}
+	for _, e := range entries {
+		f.apply(e)
+	}
+	f.appended = len(entries)
 
-	var records RecordsCache
+	if n := f.backfillCanonical(); n > 0 {
+		logger.Log.Info("canonical form of urls computed", zap.Int("count", n))
+		if err = f.compact(); err != nil {
+			f.log.Close()
+			return nil, err
+		}
+	}
 
-	fileInfo, err := file.Stat()
+	f.clicksDB, f.clicksCache, err = openClicksFile(path + ClicksFileSuffix)
 	if err != nil {
+		f.log.Close()
 		return nil, err
 	}
 
-	if fileInfo.Size() != 0 {
-		data, err := io.ReadAll(file)
-		defer file.Close()
+	f.wg.Add(1)
+	go f.background()
+
+	return f, nil
+}
+
+// openClicksFile opens file with clicks framed like log entries and loads
+// them. Damaged last click is dropped as damaged last entry of log.
+func openClicksFile(path string) (*os.File, map[string][]Click, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clicks := make(map[string][]Click)
+	err = readLines(file, func(line []byte) error {
+		data, err := decodeLine(line)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		var c Click
+		if err = json.Unmarshal(data, &c); err != nil {
+			return err
+		}
+		clicks[c.URLID] = append(clicks[c.URLID], c)
+		return nil
+	})
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+
+	return file, clicks, nil
+}
+
+func encodeClick(c Click) ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return encodeLine(data), nil
+}
+
+// apply replays log entry. Replay is idempotent because log may repeat
+// entries already compacted into snapshot.
+func (f *FileDB) apply(e logEntry) {
+	switch e.Op {
+	case opDelete:
+		if r, ok := f.records[e.Record.ID]; ok {
+			r.Deleted = true
+			r.DeletedAt = time.Now()
+			if e.DeletedAt != nil {
+				r.DeletedAt = *e.DeletedAt
+			}
+			f.records[r.ID] = r
 		}
-		err = json.Unmarshal(data, &records)
+		return
+	case opRestore:
+		if r, ok := f.records[e.Record.ID]; ok {
+			r.Deleted = false
+			r.DeletedAt = time.Time{}
+			f.records[r.ID] = r
+			if id, ok := f.liveID(r.urlKey()); !ok || id == r.ID {
+				f.byURL[r.urlKey()] = r.ID
+			}
+		}
+		return
+	}
+	if r, ok := f.records[e.Record.ID]; ok {
+		f.unindex(r.Record)
+	}
+	if e.Record.Canonical == "" && f.opts.Canonicalize != nil {
+		f.pending = append(f.pending, e.Record.ID)
+	}
+	f.index(e.Record)
+}
+
+// backfillCanonical computes canonical form of replayed records saved before
+// canonicalization and returns number of computed records. Such records are
+// indexed by original URL until then. Records are processed in order of
+// saving, so when canonical form is already taken by another URL of the same
+// user, URL which already has it or the older one keeps it and original URL
+// stays canonical form of this one.
+func (f *FileDB) backfillCanonical() int {
+	var n int
+	for _, id := range f.pending {
+		r, ok := f.records[id]
+		if !ok || r.Canonical != "" {
+			continue
+		}
+		rec := r.Record
+		canonical, err := f.opts.Canonicalize(rec.URL)
 		if err != nil {
-			return nil, err
+			canonical = rec.URL
 		}
+		if _, ok := f.liveID(urlKey{userID: rec.UserID, canonical: canonical}); ok {
+			canonical = rec.URL
+		}
+		f.unindex(rec)
+		rec.Canonical = canonical
+		f.index(rec)
+		// index resets deletion state
+		r.Record = rec
+		f.records[id] = r
+		n++
 	}
+	f.pending = nil
+	return n
+}
 
-	return &FileDB{DB: file, Cache: RecordsCache{records.Records}}, nil
+// index adds record to all indexes.
+func (f *FileDB) index(rec Record) {
+	f.records[rec.ID] = fileRecord{Record: rec}
+	// deleted or expired record does not take URL from live one, they have
+	// the same URL when URL of such record was shortened again
+	if id, ok := f.liveID(rec.urlKey()); !ok || id == rec.ID {
+		f.byURL[rec.urlKey()] = rec.ID
+	}
+	ids, ok := f.byUser[rec.UserID]
+	if !ok {
+		ids = make(map[string]struct{})
+		f.byUser[rec.UserID] = ids
+	}
+	ids[rec.ID] = struct{}{}
 }
 
-func (f *FileDB) Set(key, value, userID string) error {
-	for _, r := range f.Cache.Records {
-		if r.ID == key {
-			return nil
+// unindex removes record from all indexes.
+func (f *FileDB) unindex(rec Record) {
+	delete(f.records, rec.ID)
+	if f.byURL[rec.urlKey()] == rec.ID {
+		delete(f.byURL, rec.urlKey())
+	}
+	if ids, ok := f.byUser[rec.UserID]; ok {
+		delete(ids, rec.ID)
+		if len(ids) == 0 {
+			delete(f.byUser, rec.UserID)
 		}
 	}
+}
 
-	r := Record{ID: key, URL: value, UserID: userID}
-	data, err := json.Marshal(r)
-	if err != nil {
+// appendEntry writes entry to log according to sync policy.
+func (f *FileDB) appendEntry(e logEntry) error {
+	return f.appendEntries([]logEntry{e})
+}
+
+// appendEntries writes entries to log with single write according to sync policy.
+func (f *FileDB) appendEntries(entries []logEntry) error {
+	var data []byte
+	for _, e := range entries {
+		line, err := encodeEntry(e)
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+	}
+	if _, err := f.log.Write(data); err != nil {
 		return err
 	}
+	f.appended += len(entries)
 
-	f.Cache.Records = append(f.Cache.Records, r)
-	_, err = f.DB.Write(data)
-	if err != nil {
+	switch f.opts.Sync {
+	case SyncAlways:
+		return f.log.Sync()
+	case SyncInterval:
+		f.dirty = true
+	}
+	return nil
+}
+
+// background flushes log and compacts it until FileDB is closed.
+func (f *FileDB) background() {
+	defer f.wg.Done()
+
+	syncTicker := time.NewTicker(f.opts.SyncInterval)
+	defer syncTicker.Stop()
+	compactTicker := time.NewTicker(f.opts.CompactInterval)
+	defer compactTicker.Stop()
+
+	for {
+		select {
+		case <-f.done:
+			return
+		case <-syncTicker.C:
+			f.mu.Lock()
+			if f.dirty {
+				if err := f.log.Sync(); err != nil {
+					logger.Log.Error("failed to sync file storage", zap.Error(err))
+				}
+				f.dirty = false
+			}
+			if f.clicksDirty {
+				if err := f.clicksDB.Sync(); err != nil {
+					logger.Log.Error("failed to sync clicks of file storage", zap.Error(err))
+				}
+				f.clicksDirty = false
+			}
+			f.mu.Unlock()
+		case <-compactTicker.C:
+			f.mu.Lock()
+			if f.appended > 0 {
+				if err := f.compact(); err != nil {
+					logger.Log.Error("failed to compact file storage", zap.Error(err))
+				}
+			}
+			f.mu.Unlock()
+		}
+	}
+}
+
+// compact writes all records into snapshot and truncates log.
+// A crash between these steps is safe because log replay is idempotent.
+func (f *FileDB) compact() error {
+	entries := make([]logEntry, 0, len(f.records))
+	for _, r := range f.records {
+		entries = append(entries, logEntry{Op: opSet, Record: r.Record})
+		if r.Deleted {
+			entries = append(entries, deleteEntry(r.ID, r.UserID, r.DeletedAt))
+		}
+	}
+	if err := writeSnapshot(f.path+SnapshotFileSuffix, entries); err != nil {
 		return err
 	}
 
+	if err := f.log.Truncate(0); err != nil {
+		return err
+	}
+	if err := f.log.Sync(); err != nil {
+		return err
+	}
+	f.appended = 0
+	f.dirty = false
+
+	logger.Log.Info("file storage compacted", zap.Int("records", len(f.records)))
 	return nil
 }
 
-func (f *FileDB) Get(key string) (string, error) {
-	for _, r := range f.Cache.Records {
-		if r.ID == key {
-			return r.URL, nil
-		}
+// Compact writes all records into snapshot file and truncates log.
+func (f *FileDB) Compact() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.compact()
+}
+
+func (f *FileDB) Set(_ context.Context, rec Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.records[rec.ID]; ok {
+		return ErrDuplicateID
+	}
+	if _, ok := f.liveID(rec.urlKey()); ok {
+		return ErrConstraintViolation
 	}
 
-	return "", fmt.Errorf("key %s not found in database", key)
+	if err := f.appendEntry(logEntry{Op: opSet, Record: rec}); err != nil {
+		return err
+	}
+	f.index(rec)
+
+	return nil
 }
 
-func (f *FileDB) GetAllByID(id string) (map[string]string, error) {
-	data := make(map[string]string)
-	for _, record := range f.Cache.Records {
-		if record.UserID == id {
-			data[record.ID] = record.URL
+// SetBatch saves records like Set does with one write to log and returns
+// outcome of every record.
+func (f *FileDB) SetBatch(_ context.Context, recs []Record) ([]SetResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := make([]SetResult, len(recs))
+	entries := make([]logEntry, 0, len(recs))
+	// IDs and URLs of records saved by this batch
+	ids := make(map[string]bool)
+	urls := make(map[urlKey]string)
+	for i, rec := range recs {
+		if id, ok := f.liveID(rec.urlKey()); ok {
+			results[i] = SetResult{ID: id, Status: SetStatusExists}
+			continue
+		}
+		if id, ok := urls[rec.urlKey()]; ok {
+			results[i] = SetResult{ID: id, Status: SetStatusExists}
+			continue
+		}
+		if _, ok := f.records[rec.ID]; ok || ids[rec.ID] {
+			results[i] = SetResult{ID: rec.ID, Status: SetStatusDuplicateID}
+			continue
 		}
+		ids[rec.ID] = true
+		urls[rec.urlKey()] = rec.ID
+		entries = append(entries, logEntry{Op: opSet, Record: rec})
+		results[i] = SetResult{ID: rec.ID, Status: SetStatusCreated}
+	}
+	if len(entries) == 0 {
+		return results, nil
+	}
+
+	if err := f.appendEntries(entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		f.index(e.Record)
+	}
+	return results, nil
+}
+
+func (f *FileDB) Get(ctx context.Context, key string) (string, error) {
+	rec, err := f.GetRecord(ctx, key)
+	return rec.URL, err
+}
+
+func (f *FileDB) GetRecord(_ context.Context, key string) (Record, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	r, ok := f.records[key]
+	if !ok {
+		return Record{}, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	if r.Deleted || r.Expired(time.Now()) {
+		return Record{}, ErrGone
+	}
+	return r.Record, nil
+}
+
+func (f *FileDB) GetByURL(_ context.Context, userID, canonical string) (string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	id, ok := f.liveID(urlKey{userID: userID, canonical: canonical})
+	if !ok {
+		return "", fmt.Errorf("failed to get short url: %w", ErrNotFound)
+	}
+	return id, nil
+}
+
+// liveID returns ID of record with URL key unless it is deleted or expired,
+// such record is replaced in URL index by the next record with the same URL.
+// f.mu must be held.
+func (f *FileDB) liveID(key urlKey) (string, bool) {
+	id, ok := f.byURL[key]
+	if !ok || !f.records[id].live(time.Now()) {
+		return "", false
+	}
+	return id, true
+}
+
+func (f *FileDB) GetAllByID(_ context.Context, id string) (map[string]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	data := make(map[string]string, len(f.byUser[id]))
+	for key := range f.byUser[id] {
+		data[key] = f.records[key].URL
 	}
 	return data, nil
 }
 
-func (f *FileDB) Delete(urlID, userID string) error {
+// Delete marks record as deleted when it belongs to user, otherwise it does nothing.
+func (f *FileDB) Delete(_ context.Context, urlID, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	r, ok := f.records[urlID]
+	if !ok || r.UserID != userID || r.Deleted {
+		return nil
+	}
+	e := deleteEntry(urlID, userID, time.Now())
+	if err := f.appendEntry(e); err != nil {
+		return err
+	}
+	f.apply(e)
 	return nil
 }
 
-func (f *FileDB) Ping() error {
+// DeleteBatch marks records of items as deleted like Delete does and
+// returns status of every item.
+func (f *FileDB) DeleteBatch(_ context.Context, items []DeleteItem) ([]DeleteStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := time.Now()
+	statuses := make([]DeleteStatus, len(items))
+	entries := make([]logEntry, 0, len(items))
+	for i, item := range items {
+		r, ok := f.records[item.URLID]
+		switch {
+		case !ok:
+			statuses[i] = DeleteStatusNotFound
+		case r.UserID != item.UserID:
+			statuses[i] = DeleteStatusNotOwner
+		default:
+			statuses[i] = DeleteStatusDeleted
+			if !r.Deleted {
+				entries = append(entries, deleteEntry(item.URLID, item.UserID, now))
+			}
+		}
+	}
+	if len(entries) == 0 {
+		return statuses, nil
+	}
+
+	if err := f.appendEntries(entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		f.apply(e)
+	}
+	return statuses, nil
+}
+
+// Restore clears deleted flag of user records and returns IDs of restored
+// ones. Record is not restored when its URL was shortened again.
+func (f *FileDB) Restore(_ context.Context, userID string, ids []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var restored []string
+	entries := make([]logEntry, 0, len(ids))
+	taken := make(map[urlKey]bool)
+	for _, id := range ids {
+		r, ok := f.records[id]
+		if !ok || r.UserID != userID || !r.Deleted {
+			continue
+		}
+		if _, ok = f.liveID(r.urlKey()); ok || taken[r.urlKey()] {
+			continue
+		}
+		taken[r.urlKey()] = true
+		entries = append(entries, logEntry{Op: opRestore, Record: Record{ID: id, UserID: userID}})
+		restored = append(restored, id)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if err := f.appendEntries(entries); err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		f.apply(e)
+	}
+	return restored, nil
+}
+
+// PurgeDeleted removes records deleted or expired before t and compacts log
+// to drop them from disk.
+func (f *FileDB) PurgeDeleted(_ context.Context, t time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.remove(func(r fileRecord) bool {
+		return r.Deleted && !r.DeletedAt.After(t) || r.Expired(t)
+	})
+}
+
+// ArchiveExpired removes records expired before now from URL index, records
+// are kept to answer they are gone. Archive is not logged because it is
+// restored from expiration time on replay.
+func (f *FileDB) ArchiveExpired(_ context.Context, now time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var n int64
+	for _, r := range f.records {
+		if r.Expired(now) && f.byURL[r.urlKey()] == r.ID {
+			delete(f.byURL, r.urlKey())
+			n++
+		}
+	}
+	return n, nil
+}
+
+// remove drops records matching fn together with their clicks and compacts
+// log. f.mu must be held.
+func (f *FileDB) remove(fn func(r fileRecord) bool) (int64, error) {
+	var n int64
+	for _, r := range f.records {
+		if fn(r) {
+			f.unindex(r.Record)
+			delete(f.clicksCache, r.ID)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := f.rewriteClicks(); err != nil {
+		return 0, err
+	}
+	if err := f.compact(); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func (f *FileDB) CountURLs(_ context.Context) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	var n int
+	now := time.Now()
+	for _, r := range f.records {
+		if r.live(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *FileDB) CountUsers(_ context.Context) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	users := make(map[string]bool)
+	now := time.Now()
+	for _, r := range f.records {
+		if r.live(now) {
+			users[r.UserID] = true
+		}
+	}
+	return len(users), nil
+}
+
+func (f *FileDB) AddClick(_ context.Context, c Click) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	line, err := encodeClick(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.clicksDB.Write(line); err != nil {
+		return err
+	}
+	f.clicksCache[c.URLID] = append(f.clicksCache[c.URLID], c)
+
+	switch f.opts.Sync {
+	case SyncAlways:
+		return f.clicksDB.Sync()
+	case SyncInterval:
+		f.clicksDirty = true
+	}
 	return nil
 }
 
+func (f *FileDB) GetStats(_ context.Context, urlID string) (Stats, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return aggregateClicks(f.clicksCache[urlID]), nil
+}
+
+// rewriteClicks atomically replaces clicks file with cached clicks and
+// reopens it. f.mu must be held.
+func (f *FileDB) rewriteClicks() error {
+	var data []byte
+	for _, clicks := range f.clicksCache {
+		for _, c := range clicks {
+			line, err := encodeClick(c)
+			if err != nil {
+				return err
+			}
+			data = append(data, line...)
+		}
+	}
+
+	path := f.path + ClicksFileSuffix
+	if err := replaceFile(path, data); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	f.clicksDB.Close()
+	f.clicksDB = file
+	f.clicksDirty = false
+	return nil
+}
+
+func (f *FileDB) Ping(_ context.Context) error {
+	return nil
+}
+
+// Health reports size of log and snapshot files and checks that log can be
+// appended and directory allows to write snapshot on compaction.
+func (f *FileDB) Health(_ context.Context) (Health, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	h := Health{Storage: StorageFile}
+	for _, path := range []string{f.path, f.path + SnapshotFileSuffix} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return h, err
+		}
+		h.SizeBytes += info.Size()
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return h, err
+	}
+	if err = file.Close(); err != nil {
+		return h, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".health-*")
+	if err != nil {
+		return h, err
+	}
+	tmp.Close()
+	return h, os.Remove(tmp.Name())
+}
+
+// Close stops background jobs, flushes log and closes files.
 func (f *FileDB) Close() error {
-	return f.DB.Close()
+	close(f.done)
+	f.wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.clicksDB.Sync(); err != nil {
+		return err
+	}
+	if err := f.clicksDB.Close(); err != nil {
+		return err
+	}
+	if err := f.log.Sync(); err != nil {
+		return err
+	}
+	return f.log.Close()
 }
@@ -0,0 +1,476 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paramonies/internal/urlnorm"
+)
+
+func TestFileDBReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "a", URL: "https://c.ru"}), ErrDuplicateID)
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "c", URL: "https://a.ru", UserID: "user"}), ErrConstraintViolation)
+	require.NoError(t, db.Delete(ctx, "a", "other"))
+	require.NoError(t, db.Delete(ctx, "b", "user"))
+	require.NoError(t, db.Set(ctx, Record{ID: "c", URL: "https://c.ru", UserID: "user"}))
+	results, err := db.SetBatch(ctx, []Record{{ID: "d", URL: "https://d.ru", UserID: "user"}, {ID: "e", URL: "https://a.ru", UserID: "user"}, {ID: "d", URL: "https://e.ru"}})
+	require.NoError(t, err)
+	assert.Equal(t, []SetResult{{ID: "d", Status: SetStatusCreated}, {ID: "a", Status: SetStatusExists}, {ID: "d", Status: SetStatusDuplicateID}}, results)
+	statuses, err := db.DeleteBatch(ctx, []DeleteItem{{URLID: "c", UserID: "user"}, {URLID: "a", UserID: "other"}, {URLID: "x", UserID: "user"}})
+	require.NoError(t, err)
+	assert.Equal(t, []DeleteStatus{DeleteStatusDeleted, DeleteStatusNotOwner, DeleteStatusNotFound}, statuses)
+	require.NoError(t, db.Close())
+
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Get(ctx, "c")
+	assert.ErrorIs(t, err, ErrGone)
+
+	url, err := db.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.ru", url)
+
+	_, err = db.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrGone)
+
+	url, err = db.Get(ctx, "d")
+	require.NoError(t, err)
+	assert.Equal(t, "https://d.ru", url)
+
+	n, err := db.CountURLs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestFileDBRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+	require.NoError(t, db.Delete(ctx, "b", "user"))
+	deletedAt := time.Now()
+
+	restored, err := db.Restore(ctx, "user", []string{"a", "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, restored)
+	require.NoError(t, db.Close())
+
+	// restore and deletion time survive reopening
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Get(ctx, "a")
+	assert.NoError(t, err)
+	n, err := db.PurgeDeleted(ctx, deletedAt.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = db.PurgeDeleted(ctx, deletedAt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = db.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	list, err := db.GetAllByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "https://a.ru"}, list)
+}
+
+func TestFileDBDeletedURL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	reopen := func(db *FileDB) *FileDB {
+		require.NoError(t, db.Close())
+		db, err := NewFileDB(path, FileDBOptions{})
+		require.NoError(t, err)
+		return db
+	}
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+
+	// URL of deleted record is shortened again and can not be restored
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://a.ru", UserID: "user"}))
+	restored, err := db.Restore(ctx, "user", []string{"a"})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	db = reopen(db)
+	require.NoError(t, db.Compact())
+	db = reopen(db)
+	id, err := db.GetByURL(ctx, "user", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "b", id)
+
+	// the first record takes URL back when it is free again
+	require.NoError(t, db.Delete(ctx, "b", "user"))
+	restored, err = db.Restore(ctx, "user", []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, restored)
+	db = reopen(db)
+	defer db.Close()
+	id, err = db.GetByURL(ctx, "user", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "a", id)
+	urls, err := db.CountURLs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, urls)
+}
+
+func TestFileDBTruncatedLastLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru"}))
+	require.NoError(t, db.Close())
+
+	// simulate crash in the middle of write
+	line, err := encodeEntry(logEntry{Op: opSet, Record: Record{ID: "b", URL: "https://b.ru"}})
+	require.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = file.Write(line[:len(line)/2])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+
+	_, err = db.Get(ctx, "a")
+	assert.NoError(t, err)
+	_, err = db.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// new entries are appended after the last complete line
+	require.NoError(t, db.Set(ctx, Record{ID: "c", URL: "https://c.ru"}))
+	require.NoError(t, db.Close())
+
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Get(ctx, "c")
+	assert.NoError(t, err)
+}
+
+func TestFileDBCorruptedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	first, err := encodeEntry(logEntry{Op: opSet, Record: Record{ID: "a", URL: "https://a.ru"}})
+	require.NoError(t, err)
+	second, err := encodeEntry(logEntry{Op: opSet, Record: Record{ID: "b", URL: "https://b.ru"}})
+	require.NoError(t, err)
+	first[len(first)-3] = 'x'
+
+	require.NoError(t, os.WriteFile(path, append(first, second...), 0644))
+
+	_, err = NewFileDB(path, FileDBOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedLog)
+}
+
+func TestFileDBDamagedFirstLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	// content of unknown format is not truncated
+	require.NoError(t, os.WriteFile(path, []byte("not a log entry"), 0644))
+	_, err := NewFileDB(path, FileDBOptions{})
+	assert.ErrorIs(t, err, ErrCorruptedLog)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len("not a log entry")), info.Size())
+
+	// the first entry cut by crash, e.g. after compaction, is discarded
+	line, err := encodeEntry(logEntry{Op: opSet, Record: Record{ID: "a", URL: "https://a.ru"}})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, line[:len(line)/2], 0644))
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileDBDamagedClicks(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	require.NoError(t, db.AddClick(ctx, Click{URLID: "a", Time: time.Now()}))
+	require.NoError(t, db.AddClick(ctx, Click{URLID: "a", Time: time.Now()}))
+	require.NoError(t, db.Close())
+
+	// the last click cut by crash is discarded
+	clicksPath := path + ClicksFileSuffix
+	data, err := os.ReadFile(clicksPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(clicksPath, data[:len(data)-10], 0644))
+
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	stats, err := db.GetStats(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Clicks)
+
+	info, err := os.Stat(clicksPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestFileDBLegacyFormat(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "concatenated records",
+			data: `{"id":"a","url":"https://a.ru","user_id":"user"}{"id":"b","url":"https://b.ru","user_id":"user"}{"id":"a","url":"https://c.ru","user_id":"user"}`,
+		},
+		{
+			name: "records object",
+			data: `{"records":[{"id":"a","url":"https://a.ru","user_id":"user"},{"id":"b","url":"https://b.ru","user_id":"user"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "urls.log")
+			require.NoError(t, os.WriteFile(path, []byte(tt.data), 0644))
+
+			db, err := NewFileDB(path, FileDBOptions{})
+			require.NoError(t, err)
+			url, err := db.Get(ctx, "a")
+			require.NoError(t, err)
+			assert.Equal(t, "https://a.ru", url)
+			urls, err := db.GetAllByID(ctx, "user")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"a": "https://a.ru", "b": "https://b.ru"}, urls)
+			require.NoError(t, db.Close())
+
+			// file is converted to log format and survives reopening
+			db, err = NewFileDB(path, FileDBOptions{})
+			require.NoError(t, err)
+			defer db.Close()
+			url, err = db.Get(ctx, "b")
+			require.NoError(t, err)
+			assert.Equal(t, "https://b.ru", url)
+		})
+	}
+}
+
+func TestFileDBBackfillCanonical(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+	opts := FileDBOptions{Canonicalize: func(rawURL string) (string, error) {
+		return urlnorm.Canonicalize(rawURL, urlnorm.Options{})
+	}}
+
+	// records saved before canonicalization
+	data := `{"id":"a","url":"HTTPS://Example.com:443/a","user_id":"user"}` +
+		`{"id":"b","url":"https://example.com/a","user_id":"user"}` +
+		`{"id":"c","url":"https://Example.com/c","user_id":"user"}` +
+		`{"id":"d","url":"https://EXAMPLE.com/c","user_id":"user"}` +
+		`{"id":"e","url":"https://Example.com/e","user_id":"other"}`
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+
+	tests := []struct {
+		name   string
+		userID string
+		url    string
+		want   string
+	}{
+		{name: "computed", userID: "other", url: "https://example.com/e", want: "e"},
+		{name: "already canonical keeps it", userID: "user", url: "https://example.com/a", want: "b"},
+		{name: "clash with already canonical", userID: "user", url: "HTTPS://Example.com:443/a", want: "a"},
+		{name: "older keeps it", userID: "user", url: "https://example.com/c", want: "c"},
+		{name: "clash with older", userID: "user", url: "https://EXAMPLE.com/c", want: "d"},
+	}
+	check := func(t *testing.T, db *FileDB) {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				id, err := db.GetByURL(ctx, tt.userID, tt.url)
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, id)
+			})
+		}
+	}
+
+	db, err := NewFileDB(path, opts)
+	require.NoError(t, err)
+	check(t, db)
+	require.NoError(t, db.Close())
+
+	// computed canonical form is persisted
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	check(t, db)
+}
+
+func TestFileDBCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{Sync: SyncInterval})
+	require.NoError(t, err)
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "expired", URL: "https://c.ru", ExpiresAt: time.Now()}))
+	require.NoError(t, db.Delete(ctx, "b", "user"))
+	require.NoError(t, db.Compact())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Zero(t, info.Size())
+
+	require.NoError(t, db.Set(ctx, Record{ID: "d", URL: "https://d.ru", UserID: "user"}))
+	n, err := db.ArchiveExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	require.NoError(t, db.Set(ctx, Record{ID: "again", URL: "https://c.ru"}))
+	require.NoError(t, db.Close())
+
+	db, err = NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+
+	list, err := db.GetAllByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "https://a.ru", "b": "https://b.ru", "d": "https://d.ru"}, list)
+	_, err = db.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrGone)
+	_, err = db.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrGone)
+	id, err := db.GetByURL(ctx, "", "https://c.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "again", id)
+}
+
+func TestNewFileDBInvalidSyncPolicy(t *testing.T) {
+	_, err := NewFileDB(filepath.Join(t.TempDir(), "urls.log"), FileDBOptions{Sync: "sometimes"})
+	assert.ErrorIs(t, err, ErrInvalidSyncPolicy)
+}
+
+// newFilledFileDB creates FileDB with n records of 100 users.
+func newFilledFileDB(b *testing.B, n int) *FileDB {
+	ctx := context.Background()
+	db, err := NewFileDB(filepath.Join(b.TempDir(), "urls.log"), FileDBOptions{Sync: SyncNever})
+	require.NoError(b, err)
+	for i := 0; i < n; i++ {
+		id := strconv.Itoa(i)
+		require.NoError(b, db.Set(ctx, Record{ID: id, URL: "http://test_link_" + id + ".ru", UserID: strconv.Itoa(i % 100)}))
+	}
+	return db
+}
+
+func BenchmarkFileDB_Get(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1000, 100000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			db := newFilledFileDB(b, n)
+			defer db.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := db.Get(ctx, strconv.Itoa(i%n)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFileDB_Set(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1000, 100000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			db := newFilledFileDB(b, n)
+			defer db.Close()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				id := "new" + strconv.Itoa(i)
+				if err := db.Set(ctx, Record{ID: id, URL: "http://" + id + ".ru"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFileDB_GetAllByID(b *testing.B) {
+	ctx := context.Background()
+	// user has n records among 100000 records of other users
+	for _, n := range []int{10, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			db := newFilledFileDB(b, 100000)
+			defer db.Close()
+			for i := 0; i < n; i++ {
+				id := "user_" + strconv.Itoa(i)
+				require.NoError(b, db.Set(ctx, Record{ID: id, URL: "http://user_link_" + id + ".ru", UserID: "user"}))
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				urls, err := db.GetAllByID(ctx, "user")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(urls) != n {
+					b.Fatalf("got %d urls, want %d", len(urls), n)
+				}
+			}
+		})
+	}
+}
+
+func TestFileDBHealth(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "urls.log")
+
+	db, err := NewFileDB(path, FileDBOptions{})
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+
+	h, err := db.Health(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, StorageFile, h.Storage)
+	assert.Positive(t, h.SizeBytes)
+
+	// check leaves no files behind
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	require.NoError(t, os.Remove(path))
+	_, err = db.Health(ctx)
+	assert.Error(t, err)
+}
@@ -0,0 +1,18 @@
+package store
+
+// Kinds of storage reported by Health.
+const (
+	StorageMemory   = "memory"
+	StorageFile     = "file"
+	StoragePostgres = "postgres"
+)
+
+// Health describes state of storage reported by readiness probe. Fields not
+// applicable to kind of storage are empty.
+type Health struct {
+	Storage string `json:"storage"`
+	// MigrationVersion is ID of last applied migration of PostgresDB.
+	MigrationVersion string `json:"migration_version,omitempty"`
+	// SizeBytes is total size of log and snapshot files of FileDB.
+	SizeBytes int64 `json:"size_bytes,omitempty"`
+}
@@ -1,51 +1,282 @@
 package store
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
 
+// MapDB is in-memory repository safe for concurrent use. Deleted records are
+// kept with deleted flag like in PostgresDB, their URLs may be shortened again.
 type MapDB struct {
-	DB map[string]map[string]string
+	mu     sync.RWMutex
+	urls   map[string]mapRecord
+	byURL  map[urlKey]string
+	clicks map[string][]Click
+}
+
+type mapRecord struct {
+	Record
+	Deleted   bool
+	DeletedAt time.Time
+}
+
+// live reports whether record is neither deleted nor expired at now.
+func (r mapRecord) live(now time.Time) bool {
+	return !r.Deleted && !r.Expired(now)
 }
 
 func NewMapDB() *MapDB {
 	return &MapDB{
-		DB: make(map[string]map[string]string),
+		urls:   make(map[string]mapRecord),
+		byURL:  make(map[urlKey]string),
+		clicks: make(map[string][]Click),
 	}
 }
 
-func (db *MapDB) Set(key, val, userID string) error {
-	db.DB[key] = map[string]string{
-		"url":    val,
-		"userID": userID,
+func (db *MapDB) Set(_ context.Context, rec Record) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.urls[rec.ID]; ok {
+		return ErrDuplicateID
 	}
+	if _, ok := db.liveID(rec.urlKey()); ok {
+		return ErrConstraintViolation
+	}
+	db.urls[rec.ID] = mapRecord{Record: rec}
+	db.byURL[rec.urlKey()] = rec.ID
 	return nil
 }
 
-func (db *MapDB) Get(key string) (string, error) {
-	val, ok := db.DB[key]
+// SetBatch saves records like Set does and returns outcome of every record.
+func (db *MapDB) SetBatch(_ context.Context, recs []Record) ([]SetResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	results := make([]SetResult, len(recs))
+	for i, rec := range recs {
+		if id, ok := db.liveID(rec.urlKey()); ok {
+			results[i] = SetResult{ID: id, Status: SetStatusExists}
+			continue
+		}
+		if _, ok := db.urls[rec.ID]; ok {
+			results[i] = SetResult{ID: rec.ID, Status: SetStatusDuplicateID}
+			continue
+		}
+		db.urls[rec.ID] = mapRecord{Record: rec}
+		db.byURL[rec.urlKey()] = rec.ID
+		results[i] = SetResult{ID: rec.ID, Status: SetStatusCreated}
+	}
+	return results, nil
+}
+
+func (db *MapDB) Get(ctx context.Context, key string) (string, error) {
+	rec, err := db.GetRecord(ctx, key)
+	return rec.URL, err
+}
+
+func (db *MapDB) GetRecord(_ context.Context, key string) (Record, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	rec, ok := db.urls[key]
+	if !ok {
+		return Record{}, fmt.Errorf("key %s: %w", key, ErrNotFound)
+	}
+	if rec.Deleted || rec.Expired(time.Now()) {
+		return Record{}, ErrGone
+	}
+	return rec.Record, nil
+}
+
+func (db *MapDB) GetByURL(_ context.Context, userID, canonical string) (string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	key, ok := db.liveID(urlKey{userID: userID, canonical: canonical})
 	if !ok {
-		return "", fmt.Errorf("key %s not found in database", key)
+		return "", fmt.Errorf("failed to get short url: %w", ErrNotFound)
 	}
-	return val["url"], nil
+	return key, nil
 }
 
-func (db *MapDB) GetAllByID(id string) (map[string]string, error) {
+// liveID returns ID of record with URL key unless it is deleted or expired,
+// such record is replaced in URL index by the next record with the same URL.
+// db.mu must be held.
+func (db *MapDB) liveID(key urlKey) (string, bool) {
+	id, ok := db.byURL[key]
+	if !ok || !db.urls[id].live(time.Now()) {
+		return "", false
+	}
+	return id, true
+}
+
+func (db *MapDB) GetAllByID(_ context.Context, id string) (map[string]string, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
 	data := make(map[string]string)
-	for key, row := range db.DB {
-		if row["userID"] == id {
-			data[key] = row["url"]
+	for key, rec := range db.urls {
+		if rec.UserID == id {
+			data[key] = rec.URL
 		}
 	}
 	return data, nil
 }
 
-func (db *MapDB) Delete(urlID, userID string) error {
+// Delete marks record as deleted when it belongs to user, otherwise it does nothing.
+func (db *MapDB) Delete(_ context.Context, urlID, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	rec, ok := db.urls[urlID]
+	if !ok || rec.UserID != userID || rec.Deleted {
+		return nil
+	}
+	rec.Deleted = true
+	rec.DeletedAt = time.Now()
+	db.urls[urlID] = rec
 	return nil
 }
 
-func (db *MapDB) Ping() error {
+// DeleteBatch marks records of items as deleted like Delete does and
+// returns status of every item.
+func (db *MapDB) DeleteBatch(_ context.Context, items []DeleteItem) ([]DeleteStatus, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	statuses := make([]DeleteStatus, len(items))
+	for i, item := range items {
+		rec, ok := db.urls[item.URLID]
+		switch {
+		case !ok:
+			statuses[i] = DeleteStatusNotFound
+		case rec.UserID != item.UserID:
+			statuses[i] = DeleteStatusNotOwner
+		default:
+			if !rec.Deleted {
+				rec.Deleted = true
+				rec.DeletedAt = time.Now()
+				db.urls[item.URLID] = rec
+			}
+			statuses[i] = DeleteStatusDeleted
+		}
+	}
+	return statuses, nil
+}
+
+// Restore clears deleted flag of user records and returns IDs of restored
+// ones. Record is not restored when its URL was shortened again.
+func (db *MapDB) Restore(_ context.Context, userID string, ids []string) ([]string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var restored []string
+	for _, id := range ids {
+		rec, ok := db.urls[id]
+		if !ok || rec.UserID != userID || !rec.Deleted {
+			continue
+		}
+		if _, ok = db.liveID(rec.urlKey()); ok {
+			continue
+		}
+		rec.Deleted = false
+		rec.DeletedAt = time.Time{}
+		db.urls[id] = rec
+		db.byURL[rec.urlKey()] = id
+		restored = append(restored, id)
+	}
+	return restored, nil
+}
+
+// PurgeDeleted removes records deleted or expired before t.
+func (db *MapDB) PurgeDeleted(_ context.Context, t time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var n int64
+	for key, rec := range db.urls {
+		if rec.Deleted && !rec.DeletedAt.After(t) || rec.Expired(t) {
+			delete(db.urls, key)
+			if db.byURL[rec.urlKey()] == key {
+				delete(db.byURL, rec.urlKey())
+			}
+			delete(db.clicks, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ArchiveExpired removes records expired before now from URL index, records
+// are kept to answer they are gone.
+func (db *MapDB) ArchiveExpired(_ context.Context, now time.Time) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var n int64
+	for key, rec := range db.urls {
+		if rec.Expired(now) && db.byURL[rec.urlKey()] == key {
+			delete(db.byURL, rec.urlKey())
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (db *MapDB) CountURLs(_ context.Context) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var n int
+	now := time.Now()
+	for _, rec := range db.urls {
+		if rec.live(now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (db *MapDB) CountUsers(_ context.Context) (int, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	users := make(map[string]bool)
+	now := time.Now()
+	for _, rec := range db.urls {
+		if rec.live(now) {
+			users[rec.UserID] = true
+		}
+	}
+	return len(users), nil
+}
+
+func (db *MapDB) AddClick(_ context.Context, c Click) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.clicks[c.URLID] = append(db.clicks[c.URLID], c)
 	return nil
 }
 
+func (db *MapDB) GetStats(_ context.Context, urlID string) (Stats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return aggregateClicks(db.clicks[urlID]), nil
+}
+
+func (db *MapDB) Ping(_ context.Context) error {
+	return nil
+}
+
+func (db *MapDB) Health(_ context.Context) (Health, error) {
+	return Health{Storage: StorageMemory}, nil
+}
+
 func (db *MapDB) Close() error {
 	return nil
 }
@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMapDB(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "c", URL: "https://c.ru", UserID: "other"}))
+
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "a", URL: "https://d.ru"}), ErrDuplicateID)
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "d", URL: "https://a.ru", UserID: "user"}), ErrConstraintViolation)
+
+	url, err := db.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "https://a.ru", url)
+
+	_, err = db.Get(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	id, err := db.GetByURL(ctx, "user", "https://b.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "b", id)
+	_, err = db.GetByURL(ctx, "other", "https://b.ru")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// only owner can delete record
+	require.NoError(t, db.Delete(ctx, "c", "user"))
+	_, err = db.Get(ctx, "c")
+	assert.NoError(t, err)
+
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+	_, err = db.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrGone)
+
+	// deleted record keeps its short ID, but its URL can be shortened again
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "a", URL: "https://e.ru"}), ErrDuplicateID)
+	assert.NoError(t, db.Set(ctx, Record{ID: "e", URL: "https://a.ru", UserID: "user"}))
+	id, err = db.GetByURL(ctx, "user", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "e", id)
+	restored, err := db.Restore(ctx, "user", []string{"a"})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	list, err := db.GetAllByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "https://a.ru", "b": "https://b.ru", "e": "https://a.ru"}, list)
+
+	// deleted and expired records are not counted
+	require.NoError(t, db.Set(ctx, Record{ID: "f", URL: "https://f.ru", UserID: "expired", ExpiresAt: time.Now()}))
+	urls, err := db.CountURLs(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, urls)
+	users, err := db.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, users)
+}
+
+func TestMapDBSameURLOfUsers(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://a.ru", UserID: "other"}))
+
+	list, err := db.GetAllByID(ctx, "other")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"b": "https://a.ru"}, list)
+
+	// every user owns and deletes own link
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+	_, err = db.Get(ctx, "b")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Set(ctx, Record{ID: "c", URL: "https://a.ru", UserID: "user"}))
+	id, err := db.GetByURL(ctx, "user", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "c", id)
+}
+
+func TestMapDBSetBatch(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+
+	results, err := db.SetBatch(ctx, []Record{
+		{ID: "b", URL: "https://b.ru", UserID: "user"},
+		{ID: "c", URL: "https://a.ru", UserID: "user"},
+		{ID: "a", URL: "https://d.ru", UserID: "user"},
+		{ID: "e", URL: "https://b.ru", UserID: "user"},
+		{ID: "f", URL: "https://a.ru", UserID: "other"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []SetResult{
+		{ID: "b", Status: SetStatusCreated},
+		{ID: "a", Status: SetStatusExists},
+		{ID: "a", Status: SetStatusDuplicateID},
+		{ID: "b", Status: SetStatusExists},
+		{ID: "f", Status: SetStatusCreated},
+	}, results)
+
+	list, err := db.GetAllByID(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "https://a.ru", "b": "https://b.ru"}, list)
+}
+
+func TestMapDBRestoreAndPurge(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+
+	require.NoError(t, db.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "b", URL: "https://b.ru", UserID: "user"}))
+	require.NoError(t, db.Set(ctx, Record{ID: "c", URL: "https://c.ru", UserID: "user"}))
+	require.NoError(t, db.Delete(ctx, "a", "user"))
+	require.NoError(t, db.Delete(ctx, "b", "user"))
+
+	// only deleted records of owner are restored
+	restored, err := db.Restore(ctx, "other", []string{"a"})
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+	restored, err = db.Restore(ctx, "user", []string{"a", "c", "unknown"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, restored)
+	_, err = db.Get(ctx, "a")
+	assert.NoError(t, err)
+
+	n, err := db.PurgeDeleted(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	n, err = db.PurgeDeleted(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = db.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, db.Set(ctx, Record{ID: "d", URL: "https://b.ru"}))
+}
+
+func TestMapDBArchiveExpired(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+	now := time.Now()
+
+	require.NoError(t, db.Set(ctx, Record{ID: "expired", URL: "https://a.ru", ExpiresAt: now}))
+	require.NoError(t, db.AddClick(ctx, Click{URLID: "expired", Time: now}))
+
+	n, err := db.ArchiveExpired(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	// archived record is gone and keeps its ID
+	_, err = db.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrGone)
+	assert.ErrorIs(t, db.Set(ctx, Record{ID: "expired", URL: "https://b.ru"}), ErrDuplicateID)
+	stats, err := db.GetStats(ctx, "expired")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Clicks)
+
+	// original URL can be shortened again
+	assert.NoError(t, db.Set(ctx, Record{ID: "again", URL: "https://a.ru"}))
+	id, err := db.GetByURL(ctx, "", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "again", id)
+
+	n, err = db.PurgeDeleted(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	_, err = db.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrNotFound)
+	id, err = db.GetByURL(ctx, "", "https://a.ru")
+	require.NoError(t, err)
+	assert.Equal(t, "again", id)
+}
+
+func TestMapDBSetExpiredURL(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+
+	// expired record does not take URL before it is archived
+	require.NoError(t, db.Set(ctx, Record{ID: "expired", URL: "https://a.ru", ExpiresAt: time.Now()}))
+	_, err := db.GetByURL(ctx, "", "https://a.ru")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, db.Set(ctx, Record{ID: "again", URL: "https://a.ru"}))
+	res, err := db.SetBatch(ctx, []Record{{ID: "batch", URL: "https://a.ru"}})
+	require.NoError(t, err)
+	assert.Equal(t, []SetResult{{ID: "again", Status: SetStatusExists}}, res)
+}
+
+func TestMapDBConcurrent(t *testing.T) {
+	ctx := context.Background()
+	db := NewMapDB()
+
+	const n = 100
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("id%d", i)
+			assert.NoError(t, db.Set(ctx, Record{ID: id, URL: "https://a.ru/" + id, UserID: "user"}))
+			_, _ = db.Get(ctx, id)
+			_, _ = db.GetAllByID(ctx, "user")
+			assert.NoError(t, db.AddClick(ctx, Click{URLID: id, Time: time.Now()}))
+			assert.NoError(t, db.Delete(ctx, id, "user"))
+			_, _ = db.CountURLs(ctx)
+			_, _ = db.ArchiveExpired(ctx, time.Now())
+		}(i)
+	}
+	wg.Wait()
+
+	urls, err := db.CountURLs(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, urls)
+}
@@ -0,0 +1,223 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InstrumentedRepository records latency of every call of wrapped Repository.
+// Calls returning ErrNotFound, ErrGone, ErrConstraintViolation or
+// ErrDuplicateID are counted as successful, they are regular answers of
+// repository.
+type InstrumentedRepository struct {
+	Repository
+
+	duration *prometheus.HistogramVec
+}
+
+// NewInstrumentedRepository wraps rep and registers its metrics in reg.
+func NewInstrumentedRepository(rep Repository, reg prometheus.Registerer) (*InstrumentedRepository, error) {
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "shortener",
+		Subsystem: "repository",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of repository calls by method and result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "result"})
+	if err := reg.Register(duration); err != nil {
+		return nil, err
+	}
+	return &InstrumentedRepository{Repository: rep, duration: duration}, nil
+}
+
+// observe records call of method started at start.
+func (m *InstrumentedRepository) observe(method string, start time.Time, err error) {
+	result := "ok"
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, ErrGone) &&
+		!errors.Is(err, ErrConstraintViolation) && !errors.Is(err, ErrDuplicateID) {
+		result = "error"
+	}
+	m.duration.WithLabelValues(method, result).Observe(time.Since(start).Seconds())
+}
+
+func (m *InstrumentedRepository) Set(ctx context.Context, rec Record) error {
+	start := time.Now()
+	err := m.Repository.Set(ctx, rec)
+	m.observe("Set", start, err)
+	return err
+}
+
+func (m *InstrumentedRepository) SetBatch(ctx context.Context, recs []Record) ([]SetResult, error) {
+	start := time.Now()
+	res, err := m.Repository.SetBatch(ctx, recs)
+	m.observe("SetBatch", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) Get(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	res, err := m.Repository.Get(ctx, key)
+	m.observe("Get", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) GetRecord(ctx context.Context, key string) (Record, error) {
+	start := time.Now()
+	rec, err := m.Repository.GetRecord(ctx, key)
+	m.observe("GetRecord", start, err)
+	return rec, err
+}
+
+func (m *InstrumentedRepository) GetByURL(ctx context.Context, userID, canonical string) (string, error) {
+	start := time.Now()
+	res, err := m.Repository.GetByURL(ctx, userID, canonical)
+	m.observe("GetByURL", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) GetAllByID(ctx context.Context, id string) (map[string]string, error) {
+	start := time.Now()
+	res, err := m.Repository.GetAllByID(ctx, id)
+	m.observe("GetAllByID", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) Delete(ctx context.Context, urlID, userID string) error {
+	start := time.Now()
+	err := m.Repository.Delete(ctx, urlID, userID)
+	m.observe("Delete", start, err)
+	return err
+}
+
+func (m *InstrumentedRepository) DeleteBatch(ctx context.Context, items []DeleteItem) ([]DeleteStatus, error) {
+	start := time.Now()
+	res, err := m.Repository.DeleteBatch(ctx, items)
+	m.observe("DeleteBatch", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) Restore(ctx context.Context, userID string, ids []string) ([]string, error) {
+	start := time.Now()
+	res, err := m.Repository.Restore(ctx, userID, ids)
+	m.observe("Restore", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) PurgeDeleted(ctx context.Context, t time.Time) (int64, error) {
+	start := time.Now()
+	n, err := m.Repository.PurgeDeleted(ctx, t)
+	m.observe("PurgeDeleted", start, err)
+	return n, err
+}
+
+func (m *InstrumentedRepository) ArchiveExpired(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	n, err := m.Repository.ArchiveExpired(ctx, now)
+	m.observe("ArchiveExpired", start, err)
+	return n, err
+}
+
+func (m *InstrumentedRepository) CountURLs(ctx context.Context) (int, error) {
+	start := time.Now()
+	n, err := m.Repository.CountURLs(ctx)
+	m.observe("CountURLs", start, err)
+	return n, err
+}
+
+func (m *InstrumentedRepository) CountUsers(ctx context.Context) (int, error) {
+	start := time.Now()
+	n, err := m.Repository.CountUsers(ctx)
+	m.observe("CountUsers", start, err)
+	return n, err
+}
+
+func (m *InstrumentedRepository) AddClick(ctx context.Context, c Click) error {
+	start := time.Now()
+	err := m.Repository.AddClick(ctx, c)
+	m.observe("AddClick", start, err)
+	return err
+}
+
+func (m *InstrumentedRepository) GetStats(ctx context.Context, urlID string) (Stats, error) {
+	start := time.Now()
+	res, err := m.Repository.GetStats(ctx, urlID)
+	m.observe("GetStats", start, err)
+	return res, err
+}
+
+func (m *InstrumentedRepository) Ping(ctx context.Context) error {
+	start := time.Now()
+	err := m.Repository.Ping(ctx)
+	m.observe("Ping", start, err)
+	return err
+}
+
+func (m *InstrumentedRepository) Health(ctx context.Context) (Health, error) {
+	start := time.Now()
+	res, err := m.Repository.Health(ctx)
+	m.observe("Health", start, err)
+	return res, err
+}
+
+// PoolCollector exports statistics of PostgreSQL connection pool.
+type PoolCollector struct {
+	pool *pgxpool.Pool
+
+	acquiredConns     *prometheus.Desc
+	idleConns         *prometheus.Desc
+	constructingConns *prometheus.Desc
+	totalConns        *prometheus.Desc
+	maxConns          *prometheus.Desc
+	acquireCount      *prometheus.Desc
+	acquireDuration   *prometheus.Desc
+	emptyAcquires     *prometheus.Desc
+	canceledAcquires  *prometheus.Desc
+}
+
+// NewPoolCollector create collector of pool statistics.
+func NewPoolCollector(pool *pgxpool.Pool) *PoolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("shortener", "pgxpool", name), help, nil, nil)
+	}
+	return &PoolCollector{
+		pool:              pool,
+		acquiredConns:     desc("acquired_conns", "Number of currently acquired connections."),
+		idleConns:         desc("idle_conns", "Number of currently idle connections."),
+		constructingConns: desc("constructing_conns", "Number of connections being constructed."),
+		totalConns:        desc("total_conns", "Total number of connections in the pool."),
+		maxConns:          desc("max_conns", "Maximum size of the pool."),
+		acquireCount:      desc("acquire_total", "Number of successful connection acquires."),
+		acquireDuration:   desc("acquire_duration_seconds_total", "Total time spent acquiring connections."),
+		emptyAcquires:     desc("empty_acquire_total", "Number of acquires which waited for a connection."),
+		canceledAcquires:  desc("canceled_acquire_total", "Number of acquires cancelled by context."),
+	}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.acquiredConns
+	ch <- c.idleConns
+	ch <- c.constructingConns
+	ch <- c.totalConns
+	ch <- c.maxConns
+	ch <- c.acquireCount
+	ch <- c.acquireDuration
+	ch <- c.emptyAcquires
+	ch <- c.canceledAcquires
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquiredConns, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idleConns, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.constructingConns, prometheus.GaugeValue, float64(s.ConstructingConns()))
+	ch <- prometheus.MustNewConstMetric(c.totalConns, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.maxConns, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.acquireDuration, prometheus.CounterValue, s.AcquireDuration().Seconds())
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquires, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.canceledAcquires, prometheus.CounterValue, float64(s.CanceledAcquireCount()))
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failingPing is repository which can not be reached.
+type failingPing struct {
+	*MapDB
+}
+
+func (failingPing) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestInstrumentedRepository(t *testing.T) {
+	ctx := context.Background()
+	reg := prometheus.NewRegistry()
+	m, err := NewInstrumentedRepository(failingPing{MapDB: NewMapDB()}, reg)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Set(ctx, Record{ID: "a", URL: "https://a.ru", UserID: "user"}))
+	_, err = m.Get(ctx, "a")
+	require.NoError(t, err)
+	// unknown ID is regular answer
+	_, err = m.Get(ctx, "b")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.Error(t, m.Ping(ctx))
+
+	count := func(method, result string) uint64 {
+		var c uint64
+		metrics, err := reg.Gather()
+		require.NoError(t, err)
+		for _, mf := range metrics {
+			for _, metric := range mf.GetMetric() {
+				labels := map[string]string{}
+				for _, l := range metric.GetLabel() {
+					labels[l.GetName()] = l.GetValue()
+				}
+				if labels["method"] == method && labels["result"] == result {
+					c += metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+		return c
+	}
+	assert.Equal(t, uint64(1), count("Set", "ok"))
+	assert.Equal(t, uint64(2), count("Get", "ok"))
+	assert.Equal(t, uint64(1), count("Ping", "error"))
+	assert.Equal(t, 3, testutil.CollectAndCount(m.duration))
+
+	// metrics can not be registered twice
+	_, err = NewInstrumentedRepository(NewMapDB(), reg)
+	assert.Error(t, err)
+}
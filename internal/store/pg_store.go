@@ -5,7 +5,6 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"time"
 
@@ -16,12 +15,17 @@ import (
 	"github.com/jackc/pgx/v4"
 	_ "github.com/lib/pq"
 	migrate "github.com/rubenv/sql-migrate"
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
 )
 
 var (
 	DBConnectTimeout       = 3 * time.Second
 	ErrConstraintViolation = errors.New("original url conflict")
+	ErrDuplicateID         = errors.New("short id conflict")
 	ErrGone                = errors.New("gone")
+	ErrNotFound            = errors.New("not found")
 	MigDirName             = "migrations"
 )
 
@@ -34,19 +38,19 @@ func NewPostgresDB(dsn string) (*PostgresDB, error) {
 	defer cancel()
 	conn, err := pgxpool.Connect(ctx, dsn)
 	if err != nil {
-		log.Printf("failed to establishe a connection with a PostgreSQL server: %v", err)
+		logger.Log.Error("failed to establish a connection with a PostgreSQL server", zap.Error(err))
 		return nil, err
 	}
 
 	db, err := sql.Open("postgres", dsn)
 	if err != nil {
-		log.Printf("failed to open DB: %v", err)
+		logger.Log.Error("failed to open DB", zap.Error(err))
 		return nil, err
 	}
 
 	rootDir, err := os.Getwd()
 	if err != nil {
-		log.Println(rootDir)
+		logger.Log.Error("failed to get working directory", zap.Error(err))
 		return nil, err
 	}
 
@@ -58,32 +62,54 @@ func NewPostgresDB(dsn string) (*PostgresDB, error) {
 
 	n, err := migrate.Exec(db, "postgres", migrations, migrate.Up)
 	if err != nil {
-		log.Printf("failed to apply migrations: %v", err)
+		logger.Log.Error("failed to apply migrations", zap.Error(err))
 		return nil, err
 	}
-	log.Printf("Applied %d migrations!\n", n)
+	logger.Log.Info("migrations applied", zap.Int("count", n))
 
 	return &PostgresDB{Conn: conn}, nil
 }
 
-func (p *PostgresDB) Set(key, val, userID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DBConnectTimeout)
+// Set saves record. Expired record with the same URL is archived to save it again.
+func (p *PostgresDB) Set(ctx context.Context, rec Record) error {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
 	defer cancel()
 
+	err := p.insert(ctx, rec)
+	if !errors.Is(err, ErrConstraintViolation) {
+		return err
+	}
+	n, errArchive := p.archiveExpiredURL(ctx, rec.UserID, rec.CanonicalURL())
+	if errArchive != nil || n == 0 {
+		return err
+	}
+	return p.insert(ctx, rec)
+}
+
+func (p *PostgresDB) insert(ctx context.Context, rec Record) error {
 	query := `
 INSERT INTO urls 
 (
     short,
     original,
     user_id,
-    deleted
+    canonical,
+    deleted,
+    expires_at
 )
-VALUES ($1, $2, $3, false)
+VALUES ($1, $2, $3, $4, false, $5)
 RETURNING id
 `
+	var expiresAt *time.Time
+	if !rec.ExpiresAt.IsZero() {
+		expiresAt = &rec.ExpiresAt
+	}
+
 	var id string
-	row := p.Conn.QueryRow(ctx, query, key, val, userID)
-	if err := row.Scan(&id); err != nil {
+	ctx, span := startQuery(ctx, "insert_url", query)
+	err := p.Conn.QueryRow(ctx, query, rec.ID, rec.URL, rec.UserID, rec.CanonicalURL(), expiresAt).Scan(&id)
+	endQueryRow(span, err)
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return errors.New("failed to insert new row")
 		}
@@ -91,6 +117,9 @@ RETURNING id
 		var pgerr *pgconn.PgError
 		if errors.As(err, &pgerr) {
 			if pgerrcode.IsIntegrityConstraintViolation(pgerr.SQLState()) {
+				if pgerr.ConstraintName == "short" {
+					return ErrDuplicateID
+				}
 				return ErrConstraintViolation
 			}
 		}
@@ -99,46 +128,197 @@ RETURNING id
 	return nil
 }
 
-func (p *PostgresDB) Get(key string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DBConnectTimeout)
+// SetBatch saves records with one multi-row insert in transaction. Records
+// conflicting with saved ones are skipped and reported in results, expired
+// records with the same URLs are archived before.
+func (p *PostgresDB) SetBatch(ctx context.Context, recs []Record) ([]SetResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	ids := make([]string, 0, len(recs))
+	urls := make([]string, 0, len(recs))
+	users := make([]string, 0, len(recs))
+	canonicals := make([]string, 0, len(recs))
+	expires := make([]*time.Time, 0, len(recs))
+	for i := range recs {
+		ids = append(ids, recs[i].ID)
+		urls = append(urls, recs[i].URL)
+		users = append(users, recs[i].UserID)
+		canonicals = append(canonicals, recs[i].CanonicalURL())
+		if recs[i].ExpiresAt.IsZero() {
+			expires = append(expires, nil)
+		} else {
+			expires = append(expires, &recs[i].ExpiresAt)
+		}
+	}
+
+	tx, err := p.Conn.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+UPDATE urls SET archived = true
+WHERE (user_id, canonical) IN (SELECT * FROM unnest($1::text[], $2::text[]))
+    AND expires_at <= now() AND archived = false
+`
+	archiveCtx, span := startQuery(ctx, "archive_expired_urls", query)
+	tag, err := tx.Exec(archiveCtx, query, users, canonicals)
+	endQuery(span, tag.RowsAffected(), err)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+INSERT INTO urls (short, original, user_id, canonical, deleted, expires_at)
+SELECT short, original, user_id, canonical, false, expires_at
+FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[])
+    AS t(short, original, user_id, canonical, expires_at)
+ON CONFLICT DO NOTHING
+RETURNING short, original, user_id, canonical
+`
+	created, err := queryRecords(ctx, tx, "insert_urls", query, ids, urls, users, canonicals, expires)
+	if err != nil {
+		return nil, err
+	}
+	query = `
+SELECT short, original, user_id, canonical
+FROM urls WHERE (user_id, canonical) IN (SELECT * FROM unnest($1::text[], $2::text[]))
+    AND archived = false AND deleted = false
+`
+	saved, err := queryRecords(ctx, tx, "select_urls_by_url", query, users, canonicals)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	createdIDs := make(map[string]bool, len(created))
+	for _, rec := range created {
+		createdIDs[rec.ID] = true
+	}
+	byURL := make(map[urlKey]string, len(saved))
+	for _, rec := range saved {
+		byURL[rec.urlKey()] = rec.ID
+	}
+
+	results := make([]SetResult, len(recs))
+	for i, rec := range recs {
+		id, ok := byURL[rec.urlKey()]
+		switch {
+		case ok && id == rec.ID && createdIDs[rec.ID]:
+			results[i] = SetResult{ID: rec.ID, Status: SetStatusCreated}
+			// the same record repeated in batch is reported as existing
+			delete(createdIDs, rec.ID)
+		case ok:
+			results[i] = SetResult{ID: id, Status: SetStatusExists}
+		default:
+			results[i] = SetResult{ID: rec.ID, Status: SetStatusDuplicateID}
+		}
+	}
+	return results, nil
+}
+
+// queryRecords returns records from rows of short, original, user_id and
+// canonical columns returned by statement with name.
+func queryRecords(ctx context.Context, tx pgx.Tx, name, query string, args ...interface{}) (recs []Record, err error) {
+	ctx, span := startQuery(ctx, name, query)
+	defer func() { endQuery(span, int64(len(recs)), err) }()
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rec Record
+		if err = rows.Scan(&rec.ID, &rec.URL, &rec.UserID, &rec.Canonical); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, rows.Err()
+}
+
+func (p *PostgresDB) Get(ctx context.Context, key string) (string, error) {
+	rec, err := p.GetRecord(ctx, key)
+	return rec.URL, err
+}
+
+func (p *PostgresDB) GetRecord(ctx context.Context, key string) (Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
 	defer cancel()
 
 	query := `
-SELECT original, deleted
+SELECT original, user_id, canonical, expires_at, deleted OR coalesce(expires_at <= now(), false)
 FROM urls WHERE short=$1
 `
-	var original string
+	rec := Record{ID: key}
+	var expiresAt *time.Time
 	var deleted bool
-	row := p.Conn.QueryRow(ctx, query, key)
-	if err := row.Scan(&original, &deleted); err != nil {
+	ctx, span := startQuery(ctx, "select_url", query)
+	err := p.Conn.QueryRow(ctx, query, key).Scan(&rec.URL, &rec.UserID, &rec.Canonical, &expiresAt, &deleted)
+	endQueryRow(span, err)
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return "", errors.New("failed to get original url")
+			return Record{}, fmt.Errorf("failed to get original url: %w", ErrNotFound)
 		}
-		return "", err
+		return Record{}, err
 	}
 
 	if deleted {
-		return "", ErrGone
+		return Record{}, ErrGone
+	}
+	if expiresAt != nil {
+		rec.ExpiresAt = *expiresAt
 	}
 
-	return original, nil
+	return rec, nil
 }
 
-func (p *PostgresDB) GetAllByID(id string) (map[string]string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DBConnectTimeout)
+func (p *PostgresDB) GetByURL(ctx context.Context, userID, canonical string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+SELECT short
+FROM urls WHERE user_id=$1 and canonical=$2 and archived = false and deleted = false
+`
+	var short string
+	ctx, span := startQuery(ctx, "select_short_by_url", query)
+	err := p.Conn.QueryRow(ctx, query, userID, canonical).Scan(&short)
+	endQueryRow(span, err)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("failed to get short url: %w", ErrNotFound)
+		}
+		return "", err
+	}
+
+	return short, nil
+}
+
+func (p *PostgresDB) GetAllByID(ctx context.Context, id string) (data map[string]string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
 	defer cancel()
 
 	query := `
 SELECT short,original
 FROM urls WHERE user_id=$1
 `
+	ctx, span := startQuery(ctx, "select_user_urls", query)
+	defer func() { endQuery(span, int64(len(data)), err) }()
+
 	rows, err := p.Conn.Query(ctx, query, id)
 	if err != nil {
-		rows.Close()
 		return nil, err
 	}
+	defer rows.Close()
 
-	data := make(map[string]string)
+	data = make(map[string]string)
 	var short, original string
 	for rows.Next() {
 		err = rows.Scan(&short, &original)
@@ -147,32 +327,424 @@ FROM urls WHERE user_id=$1
 		}
 		data[short] = original
 	}
-	return data, nil
+	return data, rows.Err()
 }
 
-func (p *PostgresDB) Delete(urlID, userID string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), DBConnectTimeout)
+func (p *PostgresDB) Delete(ctx context.Context, urlID, userID string) error {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
 	defer cancel()
 
 	query := `
 UPDATE urls 
-SET deleted = true
+SET deleted = true, deleted_at = now()
 WHERE short = $1 and user_id = $2 and deleted= false
 `
-	rows, err := p.Conn.Query(ctx, query, urlID, userID)
+	ctx, span := startQuery(ctx, "delete_url", query)
+	tag, err := p.Conn.Exec(ctx, query, urlID, userID)
+	endQuery(span, tag.RowsAffected(), err)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return errors.New("record not found or already deleted")
 		}
 		return err
 	}
-	defer rows.Close()
 
 	return nil
 }
 
-func (p *PostgresDB) Ping() error {
-	return p.Conn.Ping(context.Background())
+// DeleteBatch marks URLs of items as deleted with one UPDATE per user and
+// returns status of every item. All statements are sent in a single round trip.
+func (p *PostgresDB) DeleteBatch(ctx context.Context, items []DeleteItem) ([]DeleteStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	var users []string
+	ids := make([]string, 0, len(items))
+	byUser := make(map[string][]string)
+	for _, item := range items {
+		if _, ok := byUser[item.UserID]; !ok {
+			users = append(users, item.UserID)
+		}
+		byUser[item.UserID] = append(byUser[item.UserID], item.URLID)
+		ids = append(ids, item.URLID)
+	}
+
+	query := `
+UPDATE urls 
+SET deleted = true, deleted_at = now()
+WHERE user_id = $1 and short = ANY($2) and deleted = false
+`
+	batch := &pgx.Batch{}
+	for _, userID := range users {
+		batch.Queue(query, userID, byUser[userID])
+	}
+	batch.Queue(`SELECT short, user_id FROM urls WHERE short = ANY($1)`, ids)
+
+	owners, err := p.sendDeleteBatch(ctx, query, batch, len(users))
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]DeleteStatus, len(items))
+	for i, item := range items {
+		owner, ok := owners[item.URLID]
+		switch {
+		case !ok:
+			statuses[i] = DeleteStatusNotFound
+		case owner != item.UserID:
+			statuses[i] = DeleteStatusNotOwner
+		default:
+			statuses[i] = DeleteStatusDeleted
+		}
+	}
+	return statuses, nil
+}
+
+// sendDeleteBatch sends batch of n updates followed by select of owners and
+// returns owners of selected URLs.
+func (p *PostgresDB) sendDeleteBatch(ctx context.Context, query string, batch *pgx.Batch, n int) (owners map[string]string, err error) {
+	var deleted int64
+	ctx, span := startQuery(ctx, "delete_urls", query)
+	defer func() { endQuery(span, deleted, err) }()
+
+	br := p.Conn.SendBatch(ctx, batch)
+	defer br.Close()
+	for i := 0; i < n; i++ {
+		var tag pgconn.CommandTag
+		if tag, err = br.Exec(); err != nil {
+			return nil, err
+		}
+		deleted += tag.RowsAffected()
+	}
+
+	rows, err := br.Query()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	owners = make(map[string]string)
+	var short, userID string
+	for rows.Next() {
+		if err = rows.Scan(&short, &userID); err != nil {
+			return nil, err
+		}
+		owners[short] = userID
+	}
+	return owners, rows.Err()
+}
+
+// Restore clears deleted flag of user URLs and returns IDs of restored ones.
+// URL is not restored when it was shortened again, only the newest of deleted
+// URLs with the same canonical form is restored.
+func (p *PostgresDB) Restore(ctx context.Context, userID string, ids []string) (restored []string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+UPDATE urls 
+SET deleted = false, deleted_at = NULL
+WHERE id IN (
+    SELECT DISTINCT ON (canonical) id
+    FROM urls AS d
+    WHERE user_id = $1 and short = ANY($2) and deleted = true
+        and NOT EXISTS (
+            SELECT 1 FROM urls AS l
+            WHERE l.user_id = d.user_id and l.canonical = d.canonical
+                and l.deleted = false and l.archived = false
+        )
+    ORDER BY canonical, created_at DESC
+)
+RETURNING short
+`
+	ctx, span := startQuery(ctx, "restore_urls", query)
+	defer func() { endQuery(span, int64(len(restored)), err) }()
+
+	rows, err := p.Conn.Query(ctx, query, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var short string
+	for rows.Next() {
+		if err = rows.Scan(&short); err != nil {
+			return nil, err
+		}
+		restored = append(restored, short)
+	}
+	return restored, rows.Err()
+}
+
+// PurgeDeleted removes URLs deleted or expired before t.
+func (p *PostgresDB) PurgeDeleted(ctx context.Context, t time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+DELETE FROM urls
+WHERE deleted = true and deleted_at <= $1 or expires_at <= $1
+`
+	ctx, span := startQuery(ctx, "purge_deleted", query)
+	tag, err := p.Conn.Exec(ctx, query, t)
+	endQuery(span, tag.RowsAffected(), err)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ArchiveExpired marks URLs expired before now as archived, so they do not
+// take their original URLs.
+func (p *PostgresDB) ArchiveExpired(ctx context.Context, now time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+UPDATE urls SET archived = true
+WHERE expires_at <= $1 and archived = false
+`
+	ctx, span := startQuery(ctx, "archive_expired", query)
+	tag, err := p.Conn.Exec(ctx, query, now)
+	endQuery(span, tag.RowsAffected(), err)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// backfillBatchSize limits rows computed by one query of BackfillCanonical.
+const backfillBatchSize = 1000
+
+// BackfillCanonical computes canonical form of URLs saved before
+// canonicalization and returns number of computed rows. Rows are processed in
+// order of creation, so when canonical form is already taken by another URL of
+// the same user, URL which already has it or the older one keeps it and
+// original URL stays canonical form of this one.
+func (p *PostgresDB) BackfillCanonical(ctx context.Context, canonicalize func(string) (string, error)) (int, error) {
+	query := `
+SELECT id, original
+FROM urls WHERE canonical_pending
+ORDER BY created_at, id
+LIMIT $1
+`
+	var total int
+	for {
+		rows, err := p.selectPending(ctx, query)
+		if err != nil {
+			return total, err
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+		for _, r := range rows {
+			canonical, err := canonicalize(r.original)
+			if err != nil {
+				canonical = r.original
+			}
+			if err = p.setCanonical(ctx, r.id, canonical); errors.Is(err, ErrConstraintViolation) {
+				err = p.setCanonical(ctx, r.id, r.original)
+			}
+			if err != nil {
+				return total, err
+			}
+			total++
+		}
+	}
+}
+
+type pendingRow struct {
+	id       string
+	original string
+}
+
+func (p *PostgresDB) selectPending(ctx context.Context, query string) (pending []pendingRow, err error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	ctx, span := startQuery(ctx, "select_canonical_pending", query)
+	defer func() { endQuery(span, int64(len(pending)), err) }()
+
+	rows, err := p.Conn.Query(ctx, query, backfillBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r pendingRow
+		if err = rows.Scan(&r.id, &r.original); err != nil {
+			return nil, err
+		}
+		pending = append(pending, r)
+	}
+	return pending, rows.Err()
+}
+
+func (p *PostgresDB) setCanonical(ctx context.Context, id, canonical string) error {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+UPDATE urls SET canonical = $2, canonical_pending = false
+WHERE id = $1
+`
+	ctx, span := startQuery(ctx, "update_canonical", query)
+	tag, err := p.Conn.Exec(ctx, query, id, canonical)
+	endQuery(span, tag.RowsAffected(), err)
+	var pgerr *pgconn.PgError
+	if errors.As(err, &pgerr) && pgerrcode.IsIntegrityConstraintViolation(pgerr.SQLState()) {
+		return ErrConstraintViolation
+	}
+	return err
+}
+
+// archiveExpiredURL archives expired URL of user and returns number of archived rows.
+func (p *PostgresDB) archiveExpiredURL(ctx context.Context, userID, canonical string) (int64, error) {
+	query := `
+UPDATE urls SET archived = true
+WHERE user_id = $1 and canonical = $2 and expires_at <= now() and archived = false
+`
+	ctx, span := startQuery(ctx, "archive_expired_url", query)
+	tag, err := p.Conn.Exec(ctx, query, userID, canonical)
+	endQuery(span, tag.RowsAffected(), err)
+	return tag.RowsAffected(), err
+}
+
+func (p *PostgresDB) CountURLs(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+SELECT count(*)
+FROM urls WHERE deleted = false and (expires_at IS NULL or expires_at > now())
+`
+	var n int
+	ctx, span := startQuery(ctx, "count_urls", query)
+	err := p.Conn.QueryRow(ctx, query).Scan(&n)
+	endQueryRow(span, err)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (p *PostgresDB) CountUsers(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+SELECT count(DISTINCT user_id)
+FROM urls WHERE deleted = false and (expires_at IS NULL or expires_at > now())
+`
+	var n int
+	ctx, span := startQuery(ctx, "count_users", query)
+	err := p.Conn.QueryRow(ctx, query).Scan(&n)
+	endQueryRow(span, err)
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+func (p *PostgresDB) AddClick(ctx context.Context, c Click) error {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	query := `
+INSERT INTO clicks
+(
+    short,
+    clicked_at,
+    referrer,
+    user_agent,
+    ip_hash
+)
+VALUES ($1, $2, $3, $4, $5)
+`
+	ctx, span := startQuery(ctx, "insert_click", query)
+	tag, err := p.Conn.Exec(ctx, query, c.URLID, c.Time, c.Referrer, c.UserAgent, c.IPHash)
+	endQuery(span, tag.RowsAffected(), err)
+	return err
+}
+
+func (p *PostgresDB) GetStats(ctx context.Context, urlID string) (Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	stats := Stats{Daily: []DayStats{}}
+
+	query := `
+SELECT count(*), count(DISTINCT ip_hash)
+FROM clicks WHERE short=$1
+`
+	spanCtx, span := startQuery(ctx, "select_click_totals", query)
+	err := p.Conn.QueryRow(spanCtx, query, urlID).Scan(&stats.Clicks, &stats.UniqueVisitors)
+	endQueryRow(span, err)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	query = `
+SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, count(*), count(DISTINCT ip_hash)
+FROM clicks WHERE short=$1
+GROUP BY day
+ORDER BY day
+`
+	if stats.Daily, err = p.queryDailyStats(ctx, query, urlID); err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// queryDailyStats returns clicks of URL by day.
+func (p *PostgresDB) queryDailyStats(ctx context.Context, query, urlID string) (daily []DayStats, err error) {
+	ctx, span := startQuery(ctx, "select_daily_clicks", query)
+	defer func() { endQuery(span, int64(len(daily)), err) }()
+
+	rows, err := p.Conn.Query(ctx, query, urlID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	daily = []DayStats{}
+	for rows.Next() {
+		var day DayStats
+		if err = rows.Scan(&day.Date, &day.Clicks, &day.UniqueVisitors); err != nil {
+			return nil, err
+		}
+		daily = append(daily, day)
+	}
+	return daily, rows.Err()
+}
+
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	return p.Conn.Ping(ctx)
+}
+
+// Health checks connection and reports ID of last applied migration.
+func (p *PostgresDB) Health(ctx context.Context) (Health, error) {
+	ctx, cancel := context.WithTimeout(ctx, DBConnectTimeout)
+	defer cancel()
+
+	h := Health{Storage: StoragePostgres}
+	query := `
+SELECT id
+FROM gorp_migrations ORDER BY id DESC LIMIT 1
+`
+	ctx, span := startQuery(ctx, "select_migration_version", query)
+	err := p.Conn.QueryRow(ctx, query).Scan(&h.MigrationVersion)
+	endQueryRow(span, err)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return h, errors.New("no migrations applied")
+		}
+		return h, err
+	}
+	return h, nil
 }
 
 func (p *PostgresDB) Close() error {
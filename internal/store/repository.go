@@ -1,11 +1,110 @@
 // Package store define repository interface.
 package store
 
+import (
+	"context"
+	"time"
+)
+
+// Repository stores short URLs. Every method except Close accepts context
+// which cancels storage operation.
 type Repository interface {
-	Set(key, val, userID string) error
-	Get(key string) (string, error)
-	GetAllByID(id string) (map[string]string, error)
-	Delete(urlID, userID string) error
-	Ping() error
+	ClickSink
+	Set(ctx context.Context, rec Record) error
+	SetBatch(ctx context.Context, recs []Record) ([]SetResult, error)
+	Get(ctx context.Context, key string) (string, error)
+	// GetRecord returns record by ID like Get returns its URL.
+	GetRecord(ctx context.Context, key string) (Record, error)
+	// GetByURL returns ID of record of user with canonical form of URL.
+	GetByURL(ctx context.Context, userID, canonical string) (string, error)
+	GetAllByID(ctx context.Context, id string) (map[string]string, error)
+	Delete(ctx context.Context, urlID, userID string) error
+	DeleteBatch(ctx context.Context, items []DeleteItem) ([]DeleteStatus, error)
+	Restore(ctx context.Context, userID string, ids []string) ([]string, error)
+	// PurgeDeleted removes records deleted or expired before t.
+	PurgeDeleted(ctx context.Context, t time.Time) (int64, error)
+	// ArchiveExpired archives records expired before now. Archived record
+	// stays gone and keeps its ID taken, but its URL can be shortened again.
+	ArchiveExpired(ctx context.Context, now time.Time) (int64, error)
+	CountURLs(ctx context.Context) (int, error)
+	CountUsers(ctx context.Context) (int, error)
+	Ping(ctx context.Context) error
+	// Health checks storage is usable and describes its state, state is
+	// returned together with error when check fails.
+	Health(ctx context.Context) (Health, error)
 	Close() error
 }
+
+// Record describes short URL.
+type Record struct {
+	ID     string `json:"id"`
+	URL    string `json:"url"`
+	UserID string `json:"user_id"`
+	// Canonical is canonical form of URL used for duplicate detection, URL
+	// is used when it is empty.
+	Canonical string `json:"canonical,omitempty"`
+	// ExpiresAt is zero for links without expiration.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// urlKey identifies canonical URL of user. Every user has own short URL for
+// the same original URL.
+type urlKey struct {
+	userID    string
+	canonical string
+}
+
+func (r Record) urlKey() urlKey {
+	return urlKey{userID: r.UserID, canonical: r.CanonicalURL()}
+}
+
+// CanonicalURL returns canonical form of record URL.
+func (r Record) CanonicalURL() string {
+	if r.Canonical == "" {
+		return r.URL
+	}
+	return r.Canonical
+}
+
+// SetStatus is outcome of saving one record of SetBatch.
+type SetStatus string
+
+const (
+	// SetStatusCreated means record is saved.
+	SetStatusCreated SetStatus = "created"
+	// SetStatusExists means original URL is already saved by the same user under ID of SetResult.
+	SetStatusExists SetStatus = "exists"
+	// SetStatusDuplicateID means short ID of record is already used.
+	SetStatusDuplicateID SetStatus = "duplicate_id"
+)
+
+// SetResult is outcome of saving one record of SetBatch.
+type SetResult struct {
+	ID     string
+	Status SetStatus
+}
+
+// DeleteItem identifies short URL to be deleted by its owner.
+type DeleteItem struct {
+	URLID  string
+	UserID string
+}
+
+// DeleteStatus is outcome of deletion of DeleteItem.
+type DeleteStatus string
+
+const (
+	// DeleteStatusDeleted means URL is deleted now or has been deleted before.
+	DeleteStatusDeleted DeleteStatus = "deleted"
+	// DeleteStatusNotFound means URL does not exist.
+	DeleteStatusNotFound DeleteStatus = "not_found"
+	// DeleteStatusNotOwner means URL belongs to another user.
+	DeleteStatusNotOwner DeleteStatus = "not_owner"
+	// DeleteStatusError means deletion failed.
+	DeleteStatusError DeleteStatus = "error"
+)
+
+// Expired reports whether record is expired at the moment now.
+func (r Record) Expired(now time.Time) bool {
+	return !r.ExpiresAt.IsZero() && !now.Before(r.ExpiresAt)
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/paramonies/internal/store")
+
+// rowsKey is attribute with number of rows returned or affected by statement.
+const rowsKey = attribute.Key("db.rows")
+
+// startQuery starts client span of SQL statement with name, text of
+// statement is recorded without arguments.
+func startQuery(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "postgres "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationKey.String(name),
+			semconv.DBStatementKey.String(query),
+		),
+	)
+}
+
+// endQuery records number of rows and error of statement and ends span.
+// No rows is not an error of statement.
+func endQuery(span trace.Span, rows int64, err error) {
+	span.SetAttributes(rowsKey.Int64(rows))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// endQueryRow ends span of statement returning single row.
+func endQueryRow(span trace.Span, err error) {
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	endQuery(span, rows, err)
+}
@@ -0,0 +1,44 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestQuerySpans(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	_, span := startQuery(context.Background(), "purge_deleted", "DELETE FROM urls")
+	endQuery(span, 3, nil)
+	_, span = startQuery(context.Background(), "select_url", "SELECT original")
+	endQueryRow(span, pgx.ErrNoRows)
+	_, span = startQuery(context.Background(), "count_urls", "SELECT count(*)")
+	endQueryRow(span, errors.New("connection refused"))
+
+	spans := rec.Ended()
+	require.Len(t, spans, 3)
+
+	assert.Equal(t, "postgres purge_deleted", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), attribute.String("db.statement", "DELETE FROM urls"))
+	assert.Contains(t, spans[0].Attributes(), rowsKey.Int64(3))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Contains(t, spans[1].Attributes(), rowsKey.Int64(0))
+	assert.Equal(t, codes.Unset, spans[1].Status().Code)
+
+	assert.Equal(t, codes.Error, spans[2].Status().Code)
+}
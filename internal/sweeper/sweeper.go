@@ -0,0 +1,69 @@
+// Package sweeper periodically archives expired short URLs and removes long ago
+// deleted and expired ones from repository.
+package sweeper
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/paramonies/internal/logger"
+	"github.com/paramonies/internal/store"
+)
+
+// DefaultInterval used when sweep interval is not configured.
+const DefaultInterval = time.Minute
+
+// Sweeper archives expired records of repository, archived records stay gone
+// but their URLs can be shortened again. Records deleted or expired more than
+// retention ago are purged, zero retention keeps them forever.
+type Sweeper struct {
+	rep       store.Repository
+	interval  time.Duration
+	retention time.Duration
+}
+
+// New create new Sweeper.
+func New(rep store.Repository, interval, retention time.Duration) *Sweeper {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Sweeper{rep: rep, interval: interval, retention: retention}
+}
+
+// Run archives expired records and purges old ones every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) {
+	logger.Log.Info("start sweeping expired URLs", zap.Duration("interval", s.interval))
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Log.Info("stop sweeping expired URLs")
+			return
+		case now := <-ticker.C:
+			s.sweep(ctx, now)
+		}
+	}
+}
+
+func (s *Sweeper) sweep(ctx context.Context, now time.Time) {
+	n, err := s.rep.ArchiveExpired(ctx, now)
+	if err != nil {
+		logger.Log.Error("failed to archive expired URLs", zap.Error(err))
+	} else if n > 0 {
+		logger.Log.Info("expired URLs archived", zap.Int64("count", n))
+	}
+
+	if s.retention <= 0 {
+		return
+	}
+	n, err = s.rep.PurgeDeleted(ctx, now.Add(-s.retention))
+	if err != nil {
+		logger.Log.Error("failed to purge deleted and expired URLs", zap.Error(err))
+	} else if n > 0 {
+		logger.Log.Info("deleted and expired URLs purged", zap.Int64("count", n))
+	}
+}
@@ -0,0 +1,60 @@
+package sweeper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/paramonies/internal/store"
+)
+
+func TestSweeper(t *testing.T) {
+	rep := store.NewMapDB()
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "expired", URL: "https://a.ru", ExpiresAt: time.Now()}))
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "alive", URL: "https://b.ru", ExpiresAt: time.Now().Add(time.Hour)}))
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "eternal", URL: "https://c.ru"}))
+
+	_, err := rep.Get(context.Background(), "expired")
+	assert.ErrorIs(t, err, store.ErrGone)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		New(rep, 10*time.Millisecond, 0).Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	// archived record stays gone, its URL can be shortened again
+	_, err = rep.Get(context.Background(), "expired")
+	assert.ErrorIs(t, err, store.ErrGone)
+	assert.NoError(t, rep.Set(context.Background(), store.Record{ID: "again", URL: "https://a.ru"}))
+	for _, id := range []string{"alive", "eternal"} {
+		_, err = rep.Get(context.Background(), id)
+		assert.NoError(t, err)
+	}
+}
+
+func TestSweeperPurgeDeleted(t *testing.T) {
+	rep := store.NewMapDB()
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "deleted", URL: "https://a.ru", UserID: "user"}))
+	require.NoError(t, rep.Set(context.Background(), store.Record{ID: "alive", URL: "https://b.ru", UserID: "user"}))
+	require.NoError(t, rep.Delete(context.Background(), "deleted", "user"))
+
+	s := New(rep, time.Minute, time.Hour)
+	s.sweep(context.Background(), time.Now())
+	_, err := rep.Get(context.Background(), "deleted")
+	assert.ErrorIs(t, err, store.ErrGone)
+
+	s.sweep(context.Background(), time.Now().Add(2*time.Hour))
+	_, err = rep.Get(context.Background(), "deleted")
+	assert.ErrorIs(t, err, store.ErrNotFound)
+	_, err = rep.Get(context.Background(), "alive")
+	assert.NoError(t, err)
+}
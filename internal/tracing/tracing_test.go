@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInitOTLP(t *testing.T) {
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	received := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		received <- body
+	}))
+	defer collector.Close()
+
+	shutdown, err := Init(context.Background(), ExporterOTLP, collector.URL)
+	require.NoError(t, err)
+
+	_, span := otel.Tracer("test").Start(context.Background(), "test-span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	select {
+	case body := <-received:
+		assert.Contains(t, string(body), "test-span")
+		assert.Contains(t, string(body), ServiceName)
+	default:
+		t.Fatal("spans are not exported")
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	_, err := Init(context.Background(), "zipkin", "")
+	assert.Error(t, err)
+
+	_, err = Init(context.Background(), ExporterOTLP, "localhost")
+	assert.Error(t, err)
+
+	shutdown, err := Init(context.Background(), ExporterNone, "")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
@@ -0,0 +1,104 @@
+// Package urlnorm converts URLs to canonical form used for duplicate detection.
+package urlnorm
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// trackingParams are query parameters removed when Options.StripTracking is set.
+// Parameters with "utm_" prefix are removed too.
+var trackingParams = map[string]bool{
+	"fbclid": true,
+	"gclid":  true,
+	"yclid":  true,
+}
+
+// hostProfile maps international domain names like idna.Lookup, but allows
+// symbols outside of STD3 rules like "_" which are used in real host names.
+var hostProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Options of URL canonicalization.
+type Options struct {
+	// StripTracking removes utm_*, fbclid, gclid and yclid query parameters.
+	StripTracking bool
+	// KeepOriginal makes short URL redirect to URL as it was submitted,
+	// canonical form is used only for duplicate detection.
+	KeepOriginal bool
+}
+
+// Canonicalize returns canonical form of rawURL: scheme and host are lower
+// cased, international domain name is converted to punycode, default port and
+// empty query are removed.
+func Canonicalize(rawURL string, opts Options) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Host != "" {
+		host, port := strings.ToLower(u.Hostname()), u.Port()
+		if net.ParseIP(host) == nil {
+			host, err = ToASCII(host)
+			if err != nil {
+				return "", err
+			}
+		}
+		if port == defaultPorts[u.Scheme] {
+			port = ""
+		}
+		u.Host = host
+		switch {
+		case port != "":
+			u.Host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			u.Host = "[" + host + "]"
+		}
+	}
+
+	u.ForceQuery = false
+	if opts.StripTracking {
+		u.RawQuery = stripTracking(u.RawQuery)
+	}
+	return u.String(), nil
+}
+
+// ToASCII converts host name to lower cased ASCII form, international
+// domain names are converted to punycode.
+func ToASCII(host string) (string, error) {
+	return hostProfile.ToASCII(strings.ToLower(host))
+}
+
+// stripTracking removes tracking parameters from query keeping order of others.
+func stripTracking(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, p := range params {
+		key := p
+		if i := strings.IndexByte(p, '='); i >= 0 {
+			key = p[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "utm_") || trackingParams[key] {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return strings.Join(kept, "&")
+}
@@ -0,0 +1,49 @@
+package urlnorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		opts  Options
+		want  string
+		isErr bool
+	}{
+		{name: "upper case scheme and host", url: "HTTPS://Example.COM/A", want: "https://example.com/A"},
+		{name: "default https port", url: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "default http port", url: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "other port", url: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{name: "underscore in host", url: "https://My_Bucket.s3.amazonaws.com/x", want: "https://my_bucket.s3.amazonaws.com/x"},
+		{name: "empty query", url: "https://example.com/a?", want: "https://example.com/a"},
+		{name: "host without path", url: "https://Example.com", want: "https://example.com"},
+		{name: "international domain", url: "https://Пример.рф/a", want: "https://xn--e1afmkfd.xn--p1ai/a"},
+		{name: "IPv6 host", url: "http://[::1]:80/a", want: "http://[::1]/a"},
+		{name: "IPv6 host with port", url: "http://[::1]:8080/a", want: "http://[::1]:8080/a"},
+		{name: "tracking kept by default", url: "https://example.com/a?utm_source=x&b=1", want: "https://example.com/a?utm_source=x&b=1"},
+		{
+			name: "tracking stripped",
+			url:  "https://example.com/a?utm_source=x&b=1&fbclid=abc&UTM_Medium=y&c=2#top",
+			opts: Options{StripTracking: true},
+			want: "https://example.com/a?b=1&c=2#top",
+		},
+		{name: "only tracking", url: "https://example.com/a?utm_source=x", opts: Options{StripTracking: true}, want: "https://example.com/a"},
+		{name: "invalid domain", url: "https://exa mple.com/", isErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.url, tt.opts)
+			if tt.isErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,4 @@
+-- +migrate Up
+alter table urls add constraint short unique (short);
+-- +migrate Down
+alter table urls drop constraint short;
@@ -0,0 +1,6 @@
+-- +migrate Up
+alter table urls add column expires_at timestamptz;
+create index urls_expires_at_idx on urls (expires_at) where expires_at is not null;
+-- +migrate Down
+drop index urls_expires_at_idx;
+alter table urls drop column expires_at;
@@ -0,0 +1,16 @@
+-- +migrate Up
+create table if not exists clicks
+(
+    id              bigserial,
+    short           text not null,
+    clicked_at      timestamptz not null default now(),
+    referrer        text not null default '',
+    user_agent      text not null default '',
+    ip_hash         text not null default '',
+
+    constraint clicks_pk primary key (id),
+    constraint clicks_short_fk foreign key (short) references urls (short) on delete cascade
+);
+create index clicks_short_clicked_at_idx on clicks (short, clicked_at);
+-- +migrate Down
+drop table clicks;
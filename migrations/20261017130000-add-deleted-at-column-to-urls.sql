@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table urls add column deleted_at timestamptz;
+update urls set deleted_at = now() where deleted;
+create index urls_deleted_at_idx on urls (deleted_at) where deleted;
+-- +migrate Down
+drop index urls_deleted_at_idx;
+alter table urls drop column deleted_at;
@@ -0,0 +1,7 @@
+-- +migrate Up
+alter table urls drop constraint original;
+alter table urls add constraint user_original unique (user_id, original);
+-- +migrate Down
+-- fails when the same original URL is saved by several users
+alter table urls drop constraint user_original;
+alter table urls add constraint original unique (original);
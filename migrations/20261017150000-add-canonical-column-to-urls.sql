@@ -0,0 +1,10 @@
+-- +migrate Up
+alter table urls add column canonical text;
+update urls set canonical = original;
+alter table urls alter column canonical set not null;
+alter table urls drop constraint user_original;
+alter table urls add constraint user_canonical unique (user_id, canonical);
+-- +migrate Down
+alter table urls drop constraint user_canonical;
+alter table urls add constraint user_original unique (user_id, original);
+alter table urls drop column canonical;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- canonical form of urls saved before canonicalization is computed on start of service
+alter table urls add column canonical_pending boolean not null default false;
+update urls set canonical_pending = true;
+create index urls_canonical_pending_idx on urls (created_at) where canonical_pending;
+-- +migrate Down
+alter table urls drop column canonical_pending;
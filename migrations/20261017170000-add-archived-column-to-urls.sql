@@ -0,0 +1,10 @@
+-- +migrate Up
+-- archived urls are expired ones, their urls can be shortened again
+alter table urls add column archived boolean not null default false;
+alter table urls drop constraint user_canonical;
+create unique index user_canonical on urls (user_id, canonical) where not archived;
+-- +migrate Down
+-- fails when url of archived record is shortened again
+drop index user_canonical;
+alter table urls add constraint user_canonical unique (user_id, canonical);
+alter table urls drop column archived;
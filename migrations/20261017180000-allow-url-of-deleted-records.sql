@@ -0,0 +1,8 @@
+-- +migrate Up
+-- urls of deleted records can be shortened again like urls of archived ones
+drop index user_canonical;
+create unique index user_canonical on urls (user_id, canonical) where not archived and not deleted;
+-- +migrate Down
+-- fails when url of deleted record is shortened again
+drop index user_canonical;
+create unique index user_canonical on urls (user_id, canonical) where not archived;